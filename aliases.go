@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// maxAliases is the most aliases a link can have
+const maxAliases = 20
+
+// reservedIDs are paths that are used by the server itself
+var reservedIDs = map[string]bool{
+	"api": true,
+}
+
+// bindAliases validates the aliases of a link. They are lowercased like IDs
+// and duplicates are dropped.
+func (link *Link) bindAliases() error {
+	var aliases []string
+	seen := map[string]bool{strings.ToLower(link.ID): true}
+	for _, alias := range link.Aliases {
+		alias = strings.ToLower(strings.TrimSpace(alias))
+		if seen[alias] {
+			continue
+		}
+		if alias == "" || strings.ContainsAny(alias, "/?#") {
+			return errors.New("Invalid alias " + alias)
+		}
+		if reservedIDs[alias] {
+			return errors.New("Alias " + alias + " is reserved")
+		}
+		seen[alias] = true
+		aliases = append(aliases, alias)
+	}
+	if len(aliases) > maxAliases {
+		return errors.New("A link can have at most " + strconv.Itoa(maxAliases) + " aliases")
+	}
+	link.Aliases = aliases
+	return nil
+}
+
+// checkAliases makes sure the ID of a link is not an alias of another link
+// and that none of its aliases are already taken by another link, either as
+// its ID or as one of its aliases
+func checkAliases(link *Link) error {
+	if link.ID != "" {
+		taken, err := aliasTaken(strings.ToLower(link.ID), link.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errors.New("ID " + link.ID + " is already used as an alias")
+		}
+	}
+
+	for _, alias := range link.Aliases {
+		exists, err := db.Exists(&Link{ID: alias})
+		if err != nil {
+			return err
+		}
+		if exists {
+			return errors.New("Alias " + alias + " is already a link")
+		}
+
+		taken, err := aliasTaken(alias, link.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errors.New("Alias " + alias + " is already used by another link")
+		}
+	}
+	return nil
+}
+
+// aliasTaken tells you if a link other than the one with the given ID has
+// the alias
+func aliasTaken(alias string, id string) (bool, error) {
+	records, err := db.Search(&Link{}, map[string]interface{}{
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{"aliases": alias},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, record := range records {
+		if !strings.EqualFold(record.ID, id) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IDTaken tells you if the generated ID of the link is already an alias of
+// another link
+func (link *Link) IDTaken() (bool, error) {
+	return aliasTaken(strings.ToLower(link.ID), link.ID)
+}
+
+// findLink loads the link with the given ID, or otherwise the link that has
+// it as an alias. IDs take precedence over aliases.
+func findLink(id string) (*Link, error) {
+	link := &Link{ID: id}
+	err := db.Get(link)
+	if err == nil {
+		return link, nil
+	}
+
+	records, searchErr := db.Search(link, map[string]interface{}{
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{"aliases": strings.ToLower(id)},
+		},
+	})
+	if searchErr != nil || len(records) == 0 {
+		return nil, err
+	}
+
+	// Searches only see the link as of the last refresh, so it is read again
+	// to not lose recent hits
+	link = &Link{ID: records[0].ID}
+	if err := db.Get(link); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindAliases(t *testing.T) {
+	require := require.New(t)
+
+	link := &Link{ID: "onboarding", Aliases: []string{" Welcome ", "welcome", "start", "Onboarding"}}
+	require.NoError(link.bindAliases())
+	require.Equal([]string{"welcome", "start"}, link.Aliases)
+
+	link = &Link{Aliases: []string{"a/b"}}
+	require.Error(link.bindAliases())
+
+	link = &Link{Aliases: []string{"api"}}
+	require.Error(link.bindAliases())
+}
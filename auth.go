@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// requestOwner returns who a request is made by, as given by an API key in
+// an `Authorization: Bearer` header. Requests without one are anonymous and
+// get an empty owner.
+func requestOwner(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", nil
+	}
+	key := []byte(strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+
+	owner := ""
+	for k, name := range config.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k), key) == 1 {
+			owner = name
+		}
+	}
+	if owner == "" {
+		return "", errors.New("Unknown API key")
+	}
+	return owner, nil
+}
+
+// EditableBy tells you if the owner may change the link. Links that were
+// created anonymously can be changed by anyone.
+func (link *Link) EditableBy(owner string) bool {
+	return link.Owner == "" || link.Owner == owner
+}
+
+// parseAPIKeys reads a list of `owner:key` pairs into a map from key to
+// owner
+func parseAPIKeys(list []string) (map[string]string, error) {
+	keys := map[string]string{}
+	for _, pair := range list {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.New("API keys must be given as owner:key")
+		}
+		keys[parts[1]] = parts[0]
+	}
+	return keys, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// CampaignDefault are campaign parameters that are added to every link to a
+// domain. Domain may contain wildcards such as `*.example.com`.
+type CampaignDefault struct {
+	Domain string            `json:"domain"`
+	Params map[string]string `json:"params"`
+}
+
+// loadCampaignDefaults reads a JSON file with a list of CampaignDefault.
+// Later entries override the parameters of earlier ones.
+func loadCampaignDefaults(path string) ([]CampaignDefault, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var defaults []CampaignDefault
+	if err := json.NewDecoder(file).Decode(&defaults); err != nil {
+		return nil, err
+	}
+	return defaults, nil
+}
+
+// validateCampaign makes sure campaign parameters can be put in a URL
+func validateCampaign(campaign map[string]string) error {
+	for name := range campaign {
+		if strings.TrimSpace(name) == "" {
+			return errors.New("Campaign parameters need a name")
+		}
+	}
+	return nil
+}
+
+// Tag adds the campaign parameters of the link and the defaults for the
+// domain of the destination to its query. Parameters of the link override
+// the defaults and an empty value removes a default. Parameters that are
+// already in the destination are left alone.
+func (link *Link) Tag(destination string) (string, error) {
+	if len(link.Campaign) == 0 && len(config.CampaignDefaults) == 0 {
+		return destination, nil
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	params := map[string]string{}
+	for _, defaults := range config.CampaignDefaults {
+		if !matchDomain([]string{defaults.Domain}, u.Hostname()) {
+			continue
+		}
+		for name, value := range defaults.Params {
+			params[name] = value
+		}
+	}
+	for name, value := range link.Campaign {
+		params[name] = value
+	}
+
+	existing := u.Query()
+	tags := url.Values{}
+	for name, value := range params {
+		if _, ok := existing[name]; ok || value == "" {
+			continue
+		}
+		tags.Set(name, value)
+	}
+	if len(tags) == 0 {
+		return destination, nil
+	}
+
+	if u.RawQuery != "" {
+		u.RawQuery += "&"
+	}
+	u.RawQuery += tags.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkTag(t *testing.T) {
+	require := require.New(t)
+
+	config.CampaignDefaults = []CampaignDefault{
+		{Domain: "*.example.com", Params: map[string]string{"utm_source": "short", "utm_medium": "link"}},
+	}
+	defer func() { config.CampaignDefaults = nil }()
+
+	link := &Link{}
+	destination, err := link.Tag("https://example.org/?b=1&a=2")
+	require.NoError(err)
+	require.Equal("https://example.org/?b=1&a=2", destination)
+
+	destination, err = link.Tag("https://shop.example.com/?b=1&a=2")
+	require.NoError(err)
+	require.Equal("https://shop.example.com/?b=1&a=2&utm_medium=link&utm_source=short", destination)
+
+	link.Campaign = map[string]string{"utm_campaign": "spring sale", "utm_medium": ""}
+	destination, err = link.Tag("https://shop.example.com/?utm_source=newsletter")
+	require.NoError(err)
+	require.Equal("https://shop.example.com/?utm_source=newsletter&utm_campaign=spring+sale", destination)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// trackingParams are query parameters that only exist to track where a
+// visitor came from. Parameters ending in `*` are matched as prefixes.
+var trackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"msclkid",
+	"yclid",
+	"igshid",
+	"mc_cid",
+	"mc_eid",
+	"_ga",
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// canonicalURL normalises a URL so that different spellings of the same
+// destination compare equal. The scheme and host are lowercased, international
+// domain names are converted to punycode, default ports and dot segments in
+// the path are removed and, if stripTracking is set, tracking parameters are
+// dropped from the query.
+func canonicalURL(rawurl string, stripTracking bool) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	if u.Host != "" {
+		hostname, port := u.Hostname(), u.Port()
+		hostname, err = asciiHostname(hostname)
+		if err != nil {
+			return "", err
+		}
+		if port == defaultPorts[u.Scheme] {
+			port = ""
+		}
+		if strings.Contains(hostname, ":") {
+			hostname = "[" + hostname + "]"
+		}
+		if port != "" {
+			hostname += ":" + port
+		}
+		u.Host = hostname
+	}
+
+	if u.Opaque == "" {
+		path := removeDotSegments(u.EscapedPath())
+		if path == "" && u.Host != "" {
+			path = "/"
+		}
+		u.Path, err = url.PathUnescape(path)
+		if err != nil {
+			return "", err
+		}
+		u.RawPath = path
+	}
+
+	if stripTracking {
+		u.RawQuery = stripTrackingParams(u.RawQuery)
+	}
+
+	return u.String(), nil
+}
+
+// asciiHostname lowercases a hostname and encodes any international labels
+// with punycode
+func asciiHostname(hostname string) (string, error) {
+	hostname = strings.ToLower(hostname)
+	if net.ParseIP(hostname) != nil {
+		return hostname, nil
+	}
+
+	labels := strings.Split(hostname, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		encoded, err := punycode(label)
+		if err != nil {
+			return "", err
+		}
+		labels[i] = "xn--" + encoded
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// removeDotSegments resolves `.` and `..` in a path as described in
+// RFC 3986 section 5.2.4
+func removeDotSegments(path string) string {
+	if path == "" {
+		return ""
+	}
+
+	var output []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				output = append(output, "")
+			}
+		case "..":
+			if len(output) > 0 && !(len(output) == 1 && output[0] == "") {
+				output = output[:len(output)-1]
+			}
+			if last {
+				output = append(output, "")
+			}
+		default:
+			output = append(output, segment)
+		}
+	}
+
+	result := strings.Join(output, "/")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
+
+func stripTrackingParams(rawquery string) string {
+	if rawquery == "" {
+		return ""
+	}
+
+	var kept []string
+	for _, param := range strings.Split(rawquery, "&") {
+		name := param
+		if i := strings.Index(param, "="); i >= 0 {
+			name = param[:i]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !isTrackingParam(strings.ToLower(name)) {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+func isTrackingParam(name string) bool {
+	for _, param := range trackingParams {
+		if strings.HasSuffix(param, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(param, "*")) {
+				return true
+			}
+		} else if name == param {
+			return true
+		}
+	}
+	return false
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Bootstring parameters for punycode as defined in RFC 3492
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// punycode encodes a single domain label as described in RFC 3492
+func punycode(label string) (string, error) {
+	runes := []rune(label)
+	output := []byte{}
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			output = append(output, byte(r))
+		}
+	}
+	basic := len(output)
+	handled := basic
+	if basic > 0 {
+		output = append(output, '-')
+	}
+
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+	for handled < len(runes) {
+		m := rune(utf8.MaxRune)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		if int(m-n) > (1<<31-1-delta)/(handled+1) {
+			return "", errors.New("Label is too long to encode")
+		}
+		delta += int(m-n) * (handled + 1)
+		n = m
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := k - bias
+				if t < punyTMin {
+					t = punyTMin
+				} else if t > punyTMax {
+					t = punyTMax
+				}
+				if q < t {
+					break
+				}
+				output = append(output, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			output = append(output, punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(output), nil
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyAdapt(delta, numPoints int, firstTime bool) int {
+	if firstTime {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	require := require.New(t)
+
+	tests := []struct {
+		in, out       string
+		stripTracking bool
+	}{
+		{"HTTPS://Example.COM", "https://example.com/", false},
+		{"http://example.com:80/a", "http://example.com/a", false},
+		{"https://example.com:443/a", "https://example.com/a", false},
+		{"https://example.com:8443/a", "https://example.com:8443/a", false},
+		{"https://example.com/a/./b/../c/", "https://example.com/a/c/", false},
+		{"https://example.com/../../a", "https://example.com/a", false},
+		{"https://example.com/a%2Fb/../c", "https://example.com/c", false},
+		{"https://münchen.de/straße", "https://xn--mnchen-3ya.de/stra%C3%9Fe", false},
+		{"https://ドメイン名例.jp", "https://xn--eckwd4c7cu47r2wf.jp/", false},
+		{"https://[::1]:443/", "https://[::1]/", false},
+		{"https://example.com/?utm_source=x&id=1&fbclid=y", "https://example.com/?utm_source=x&id=1&fbclid=y", false},
+		{"https://example.com/?utm_source=x&id=1&fbclid=y", "https://example.com/?id=1", true},
+		{"https://example.com/#Section", "https://example.com/#Section", true},
+	}
+
+	for _, test := range tests {
+		canonical, err := canonicalURL(test.in, test.stripTracking)
+		require.NoError(err)
+		require.Equal(test.out, canonical, test.in)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// resolveChain follows the destination of a link through the links in the
+// database for as long as it points to one of our own hosts. It returns the
+// first destination that is not another link, or an error if the chain loops
+// back on itself or is longer than the configured depth. Expired links are
+// followed to their fallback.
+func resolveChain(link *Link, hosts []string) (string, error) {
+	visited := map[string]bool{}
+	if link.ID != "" {
+		visited[strings.ToLower(link.ID)] = true
+	}
+	for _, alias := range link.Aliases {
+		visited[alias] = true
+	}
+
+	destination := link.URL
+	// result is where the chain leads. Fallbacks of links that can not be
+	// followed are only checked for loops, as the link may be usable again
+	// later.
+	result := destination
+	throughFallback := false
+	for depth := 0; ; depth++ {
+		u, err := url.Parse(destination)
+		if err != nil {
+			return "", err
+		}
+		if !isOwnHost(u, hosts) {
+			return result, nil
+		}
+
+		id := linkIDFromPath(u.Path)
+		if id == "" {
+			return result, nil
+		}
+		if visited[id] {
+			return "", errors.New("Link would create a redirect loop")
+		}
+		if depth >= config.MaxChainDepth {
+			return "", errors.New("Redirect chain is too long")
+		}
+		visited[id] = true
+
+		next, err := findLink(id)
+		if err != nil {
+			// The chain ends in a link that does not exist, so there is
+			// nothing further to loop back from
+			return result, nil
+		}
+		// The link may have been reached through an alias
+		if strings.ToLower(next.ID) != id && visited[strings.ToLower(next.ID)] {
+			return "", errors.New("Link would create a redirect loop")
+		}
+		visited[strings.ToLower(next.ID)] = true
+
+		switch reason := next.CanRead(); {
+		case reason == ErrExpired || reason == ErrExhausted:
+			// Visitors of the link are sent to its fallback instead
+			if next.FallbackURL == "" {
+				return result, nil
+			}
+			destination = next.FallbackURL
+			throughFallback = true
+		case reason != nil || next.URL == "":
+			// The chain ends in a link that can not be followed, or one
+			// without a destination such as a paste
+			return result, nil
+		default:
+			destination = next.URL
+			if !throughFallback {
+				result = destination
+			}
+		}
+	}
+}
+
+// isOwnHost tells you if the URL points to one of the given hosts. Hosts
+// without a port match the URL on any port.
+func isOwnHost(u *url.URL, hosts []string) bool {
+	for _, host := range hosts {
+		host = strings.ToLower(host)
+		if host == "" {
+			continue
+		}
+		if u.Host == host || (!strings.Contains(host, ":") && u.Hostname() == host) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkIDFromPath returns the ID of the link a path on our own host refers to
+func linkIDFromPath(path string) string {
+	return strings.ToLower(strings.Split(strings.TrimPrefix(path, "/"), "/")[0])
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/syntaqx/go-chi-render"
+)
+
+// maxItems is the most links a collection can hold
+const maxItems = 50
+
+// reservedItemIDs are paths below a link that are used by the server itself
+var reservedItemIDs = map[string]bool{
+	"preview": true,
+	"unlock":  true,
+	"restore": true,
+}
+
+// CollectionItem is one of the titled links listed on a collection page.
+// Items are shown in the order they are given.
+type CollectionItem struct {
+	// ID identifies the item in its URL below the collection, numbers are
+	// used for items that do not have one
+	ID    string `json:"id" form:"id"`
+	Title string `json:"title" form:"title"`
+	URL   string `json:"url" form:"url"`
+	// Hits is how many times this item was clicked
+	Hits int64 `json:"hits" form:"-"`
+}
+
+func (item CollectionItem) String() string {
+	return item.Title + " " + item.URL
+}
+
+// IsCollection tells you if the link lists several links instead of
+// redirecting
+func (link *Link) IsCollection() bool {
+	return len(link.Items) > 0
+}
+
+// bindCollection validates the items of a collection and canonicalises
+// their URLs
+func (link *Link) bindCollection() error {
+	if len(link.Items) > maxItems {
+		return errors.New("A collection can have at most " + strconv.Itoa(maxItems) + " items")
+	}
+	if link.URL != "" || link.Content != "" || link.Format != "" || link.Ciphertext != "" ||
+		len(link.Variants) > 0 || len(link.Rules) > 0 || link.FallbackURL != "" {
+		return errors.New("Collections can not have other destinations")
+	}
+	if link.ForwardPath || link.ForwardQuery || link.QueryMerge != "" {
+		return errors.New("Collections can not change their destinations")
+	}
+
+	used := map[string]bool{}
+	for i := range link.Items {
+		item := &link.Items[i]
+		item.ID = strings.ToLower(strings.TrimSpace(item.ID))
+		if item.ID != "" {
+			if strings.ContainsAny(item.ID, "/?#") || reservedItemIDs[item.ID] {
+				return errors.New("Invalid item ID " + item.ID)
+			}
+			if used[item.ID] {
+				return errors.New("Item ID " + item.ID + " is used more than once")
+			}
+			used[item.ID] = true
+		}
+
+		item.Title = strings.TrimSpace(item.Title)
+		if item.Title == "" {
+			return errors.New("Collection items need a title")
+		}
+		if len(item.Title) > maxTitleLength {
+			return errors.New("Item titles can be at most " + strconv.Itoa(maxTitleLength) + " characters")
+		}
+		if isTemplate(item.URL) {
+			return errors.New("Item URLs can not have placeholders")
+		}
+		canonical, err := checkDestination(item.URL)
+		if err != nil {
+			return err
+		}
+		item.URL = canonical
+		item.Hits = 0
+	}
+
+	next := 1
+	for i := range link.Items {
+		if link.Items[i].ID != "" {
+			continue
+		}
+		for used[strconv.Itoa(next)] {
+			next++
+		}
+		link.Items[i].ID = strconv.Itoa(next)
+		used[link.Items[i].ID] = true
+	}
+	return nil
+}
+
+// findItem returns the position of the item with the given ID or -1 if the
+// collection does not have it
+func (link *Link) findItem(id string) int {
+	id = strings.ToLower(id)
+	for i, item := range link.Items {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// showCollection counts a visit of the collection and renders its page
+func showCollection(w http.ResponseWriter, r *http.Request, link *Link) {
+	countHit(w, link, -1)
+	render.Render(w, WithTemplate(r, "link.collection"), link)
+}
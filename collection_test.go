@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindCollection(t *testing.T) {
+	require := require.New(t)
+
+	link := &Link{Items: []CollectionItem{
+		{Title: " Blog ", URL: "https://example.com/blog"},
+		{ID: "1", Title: "Shop", URL: "https://example.com/shop"},
+		{ID: "Talks", Title: "Talks", URL: "https://example.com/talks"},
+	}}
+	require.NoError(link.bindCollection())
+	require.Equal("2", link.Items[0].ID)
+	require.Equal("Blog", link.Items[0].Title)
+	require.Equal("1", link.Items[1].ID)
+	require.Equal("talks", link.Items[2].ID)
+	require.Equal(2, link.findItem("TALKS"))
+	require.Equal(-1, link.findItem("3"))
+
+	invalid := [][]CollectionItem{
+		{{Title: "", URL: "https://example.com/"}},
+		{{Title: "Home", URL: "example"}},
+		{{Title: "Home", URL: "https://example.com/{path}"}},
+		{{ID: "preview", Title: "Home", URL: "https://example.com/"}},
+		{{ID: "a/b", Title: "Home", URL: "https://example.com/"}},
+		{{ID: "a", Title: "Home", URL: "https://example.com/"}, {ID: "A", Title: "Away", URL: "https://example.com/"}},
+	}
+	for _, items := range invalid {
+		link := &Link{Items: items}
+		require.Error(link.bindCollection(), "%v", items)
+	}
+
+	link = &Link{URL: "https://example.com/", Items: []CollectionItem{{Title: "Home", URL: "https://example.com/"}}}
+	require.Error(link.bindCollection())
+}
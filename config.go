@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings of the server that can be changed through the
+// environment.
+type Config struct {
+	// Dedupe makes every new link without options reuse an existing link to
+	// the same URL, as if `?dedupe=true` had been passed.
+	Dedupe bool
+	// StripTracking removes tracking parameters such as `utm_source` from
+	// URLs before they are saved.
+	StripTracking bool
+	// Policy decides which destinations links may point to
+	Policy Policy
+	// Hosts are the domains the shortener is served from, besides the host
+	// of the current request. Links pointing to them are followed to detect
+	// redirect loops.
+	Hosts []string
+	// MaxChainDepth is how many links may be chained before a new link is
+	// rejected
+	MaxChainDepth int
+	// FlattenChains makes links that point to other links point to the
+	// final destination instead, as if `?flatten=true` had been passed.
+	FlattenChains bool
+	// ThreatListPath is the file with unsafe destinations, see ThreatList
+	ThreatListPath string
+	// ThreatAction is what happens when a visitor follows a link to an unsafe
+	// destination. It is either "block" or "warn", which shows a warning page
+	// instead of redirecting. Links to unsafe destinations can only be
+	// created when it is "warn".
+	ThreatAction string
+	// PasswordAttempts is how many wrong passwords may be tried for a link
+	// before it is locked for PasswordLockout
+	PasswordAttempts int
+	PasswordLockout  time.Duration
+	// ComingSoonURL is where visitors of links that are not active yet are
+	// sent. When it is empty a built in page is shown instead.
+	ComingSoonURL string
+	// GoneStatus is the status code for links that have expired or reached
+	// their hit limit
+	GoneStatus int
+	// DisabledURL is where visitors of disabled links are sent. When it is
+	// empty a built in page is shown instead.
+	DisabledURL string
+	// TrashPeriod is how long deleted links can be restored before they are
+	// purged
+	TrashPeriod time.Duration
+	// Interstitial decides which links show their destination before
+	// visitors are sent there
+	Interstitial InterstitialPolicy
+	// MaxPasteSize is the largest paste in bytes that can be created
+	MaxPasteSize int
+	// CampaignDefaults are campaign parameters added to links per domain
+	CampaignDefaults []CampaignDefault
+	// GeoIPPath is the MaxMind DB file countries are looked up in, see GeoIP
+	GeoIPPath string
+	// TrustedProxies are the networks of proxies whose X-Forwarded-For
+	// headers are believed when finding the address of a visitor
+	TrustedProxies []*net.IPNet
+	// APIKeys maps API keys to the owner they identify, see requestOwner
+	APIKeys map[string]string
+}
+
+var config = NewConfig()
+
+// NewConfig returns a Config with the default settings
+func NewConfig() *Config {
+	return &Config{
+		Policy: Policy{
+			Schemes:      []string{"http", "https"},
+			BlockPrivate: true,
+			MaxURLLength: 2048,
+		},
+		MaxChainDepth: 5,
+		ThreatAction:  "block",
+
+		PasswordAttempts: 5,
+		PasswordLockout:  time.Minute,
+
+		GoneStatus: http.StatusGone,
+
+		TrashPeriod: 30 * 24 * time.Hour,
+
+		MaxPasteSize: 64 * 1024,
+	}
+}
+
+// LoadConfig reads the Config from environment variables
+func LoadConfig() (*Config, error) {
+	c := NewConfig()
+
+	var err error
+	c.Dedupe, err = envBool("DEDUPE", c.Dedupe)
+	if err != nil {
+		return nil, err
+	}
+	c.StripTracking, err = envBool("STRIP_TRACKING", c.StripTracking)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Policy.Schemes = envList("ALLOWED_SCHEMES", c.Policy.Schemes)
+	c.Policy.AllowedDomains = envList("ALLOWED_DOMAINS", c.Policy.AllowedDomains)
+	c.Policy.BlockedDomains = envList("BLOCKED_DOMAINS", c.Policy.BlockedDomains)
+	allowPrivate, err := envBool("ALLOW_PRIVATE", !c.Policy.BlockPrivate)
+	if err != nil {
+		return nil, err
+	}
+	c.Policy.BlockPrivate = !allowPrivate
+	c.Policy.MaxURLLength, err = envInt("MAX_URL_LENGTH", c.Policy.MaxURLLength)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Hosts = envList("HOSTS", c.Hosts)
+	c.MaxChainDepth, err = envInt("MAX_CHAIN_DEPTH", c.MaxChainDepth)
+	if err != nil {
+		return nil, err
+	}
+	c.FlattenChains, err = envBool("FLATTEN_CHAINS", c.FlattenChains)
+	if err != nil {
+		return nil, err
+	}
+
+	c.ThreatListPath = envString("THREAT_LIST", c.ThreatListPath)
+	c.ThreatAction = envString("THREAT_ACTION", c.ThreatAction)
+	if c.ThreatAction != "block" && c.ThreatAction != "warn" {
+		return nil, errors.New("THREAT_ACTION must be block or warn")
+	}
+
+	c.PasswordAttempts, err = envInt("PASSWORD_ATTEMPTS", c.PasswordAttempts)
+	if err != nil {
+		return nil, err
+	}
+	c.PasswordLockout, err = envDuration("PASSWORD_LOCKOUT", c.PasswordLockout)
+	if err != nil {
+		return nil, err
+	}
+
+	c.ComingSoonURL = envString("COMING_SOON_URL", c.ComingSoonURL)
+	c.GoneStatus, err = envInt("GONE_STATUS", c.GoneStatus)
+	if err != nil {
+		return nil, err
+	}
+	if http.StatusText(c.GoneStatus) == "" {
+		return nil, errors.New("GONE_STATUS must be a HTTP status code")
+	}
+
+	c.DisabledURL = envString("DISABLED_URL", c.DisabledURL)
+	c.TrashPeriod, err = envDuration("TRASH_PERIOD", c.TrashPeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Interstitial.Domains = envList("INTERSTITIAL_DOMAINS", c.Interstitial.Domains)
+	c.Interstitial.External, err = envBool("INTERSTITIAL_EXTERNAL", c.Interstitial.External)
+	if err != nil {
+		return nil, err
+	}
+	c.Interstitial.NewerThan, err = envDuration("INTERSTITIAL_NEWER_THAN", c.Interstitial.NewerThan)
+	if err != nil {
+		return nil, err
+	}
+	c.Interstitial.Anonymous, err = envBool("INTERSTITIAL_ANONYMOUS", c.Interstitial.Anonymous)
+	if err != nil {
+		return nil, err
+	}
+	c.Interstitial.Countdown, err = envInt("INTERSTITIAL_COUNTDOWN", c.Interstitial.Countdown)
+	if err != nil {
+		return nil, err
+	}
+
+	c.MaxPasteSize, err = envInt("MAX_PASTE_SIZE", c.MaxPasteSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if path := os.Getenv("CAMPAIGN_DEFAULTS"); path != "" {
+		c.CampaignDefaults, err = loadCampaignDefaults(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.GeoIPPath = envString("GEOIP_DB", c.GeoIPPath)
+	c.TrustedProxies, err = parseNetworks(envList("TRUSTED_PROXIES", nil))
+	if err != nil {
+		return nil, err
+	}
+
+	c.APIKeys, err = parseAPIKeys(envList("API_KEYS", nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func envString(name string, fallback string) string {
+	s := os.Getenv(name)
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+func envBool(name string, fallback bool) (bool, error) {
+	s := os.Getenv(name)
+	if s == "" {
+		return fallback, nil
+	}
+	return strconv.ParseBool(s)
+}
+
+func envInt(name string, fallback int) (int, error) {
+	s := os.Getenv(name)
+	if s == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(s)
+}
+
+func envDuration(name string, fallback time.Duration) (time.Duration, error) {
+	s := os.Getenv(name)
+	if s == "" {
+		return fallback, nil
+	}
+	return parseDuration(s)
+}
+
+// envList reads a comma separated list
+func envList(name string, fallback []string) []string {
+	s := os.Getenv(name)
+	if s == "" {
+		return fallback
+	}
+	var list []string
+	for _, element := range strings.Split(s, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			list = append(list, element)
+		}
+	}
+	return list
+}
@@ -25,6 +25,13 @@ type Model interface {
 	GenerateID() error
 }
 
+// IDChecker can be implemented by Models whose IDs can also be taken by
+// something else than another record
+type IDChecker interface {
+	// IDTaken is called for generated IDs that no record has yet
+	IDTaken() (bool, error)
+}
+
 func modelName(m Model) string {
 	return reflect.TypeOf(m).Elem().Name()
 }
@@ -94,9 +101,21 @@ func putRequest(path string, jsonbytes []byte) (*http.Response, error) {
 	return client.Do(request)
 }
 
+func postRequest(path string, jsonbytes []byte) (*http.Response, error) {
+	request, err := http.NewRequest("POST", path, bytes.NewBuffer(jsonbytes))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Accept", "application/json")
+	return client.Do(request)
+}
+
 // Migrate makes sure that the Elastic cluster is primed for data
 // pass it a struct and it will introspect it to find what fields
-// should be added to the Mapping for the index.
+// should be added to the Mapping for the index. Fields tagged with
+// `db:"-"` are never stored and objects tagged with `enabled:false` are
+// stored without being indexed.
 func (db *DB) Migrate(m Model) error {
 	response, err := getRequest(createURL(db.URL, []string{m.Index()}))
 	if err != nil {
@@ -123,7 +142,7 @@ func (db *DB) Migrate(m Model) error {
 		if name == "" {
 			name = field.Name
 		}
-		if name == "ID" {
+		if name == "ID" || name == "-" {
 			continue
 		}
 		if len(values) == 0 {
@@ -140,6 +159,9 @@ func (db *DB) Migrate(m Model) error {
 			if strings.HasPrefix(element, "analyzer:") {
 				mappings["properties"].(map[string]interface{})[name].(map[string]interface{})["analyzer"] = strings.TrimPrefix(element, "analyzer:")
 			}
+			if element == "enabled:false" {
+				mappings["properties"].(map[string]interface{})[name].(map[string]interface{})["enabled"] = false
+			}
 		}
 	}
 
@@ -163,6 +185,16 @@ func (db *DB) Migrate(m Model) error {
 // if it does not exist (calling Prepare() and GenerateID()) or
 // update the existing database record (only calling Prepare())
 func (db *DB) Save(m Model) error {
+	return db.save(m, false)
+}
+
+// SaveAndRefresh saves a Model like Save and waits until searches see the
+// change. It is slower, so only use it where a search may follow.
+func (db *DB) SaveAndRefresh(m Model) error {
+	return db.save(m, true)
+}
+
+func (db *DB) save(m Model, refresh bool) error {
 	err := m.Prepare()
 	if err != nil {
 		return err
@@ -182,6 +214,15 @@ func (db *DB) Save(m Model) error {
 				return err
 			}
 
+			if !exists {
+				if checker, ok := m.(IDChecker); ok {
+					exists, err = checker.IDTaken()
+					if err != nil {
+						return err
+					}
+				}
+			}
+
 			// If the ID is not found in the DB we can break
 			// the loop because we have a unique ID
 			if !exists {
@@ -190,40 +231,59 @@ func (db *DB) Save(m Model) error {
 		}
 	}
 
-	val := reflect.ValueOf(m).Elem()
-	record := map[string]interface{}{}
+	jsonbytes, err := encodeRecord(m)
+	if err != nil {
+		return err
+	}
 
-	for i := 0; i < val.NumField(); i++ {
-		field := val.Type().Field(i)
-		tags := strings.Split(field.Tag.Get("db"), ";")
-		name, _ := tags[0], tags[1:]
+	path := createURL(db.URL, []string{m.Index(), modelName(m), modelID(m)})
+	if refresh {
+		path += "?refresh=wait_for"
+	}
+	response, err := putRequest(path, jsonbytes)
+	if err != nil {
+		return err
+	}
 
-		if name == "" {
-			name = field.Name
-		}
+	var dbResponse map[string]string
+	jsonResponse(response, &dbResponse)
+	result := dbResponse["result"]
 
-		record[name] = val.Field(i).Interface()
+	if result != "created" && result != "updated" && result != "noop" {
+		return errors.New("Could not insert record got " + dbResponse["result"])
 	}
 
-	jsonbytes, err := json.Marshal(record)
+	return nil
+}
 
+// Create inserts a Model with an ID chosen by Elastic, for records that are
+// never updated. Only Prepare() is called. It waits until searches see the
+// new record.
+func (db *DB) Create(m Model) error {
+	err := m.Prepare()
 	if err != nil {
 		return err
 	}
 
-	response, err := putRequest(createURL(db.URL, []string{m.Index(), modelName(m), modelID(m)}), jsonbytes)
+	jsonbytes, err := encodeRecord(m)
 	if err != nil {
 		return err
 	}
 
-	var dbResponse map[string]string
+	response, err := postRequest(createURL(db.URL, []string{m.Index(), modelName(m)})+"?refresh=wait_for", jsonbytes)
+	if err != nil {
+		return err
+	}
+
+	var dbResponse map[string]interface{}
 	jsonResponse(response, &dbResponse)
-	result := dbResponse["result"]
+	id, _ := dbResponse["_id"].(string)
 
-	if result != "created" && result != "updated" && result != "noop" {
-		return errors.New("Could not insert record got " + dbResponse["result"])
+	if dbResponse["result"] != "created" || id == "" {
+		return errors.New("Could not create " + modelName(m))
 	}
 
+	reflect.ValueOf(m).Elem().FieldByName("ID").SetString(id)
 	return nil
 }
 
@@ -242,6 +302,7 @@ func (db *DB) Exists(m Model) (bool, error) {
 	return true, nil
 }
 
+// Get will fetch the Model with the same ID from the database
 func (db *DB) Get(m Model) error {
 	response, err := getRequest(createURL(db.URL, []string{m.Index(), modelName(m), modelID(m), "_source"}))
 	if err != nil {
@@ -255,6 +316,99 @@ func (db *DB) Get(m Model) error {
 	record := map[string]interface{}{}
 	jsonResponse(response, &record)
 
+	return decodeRecord(m, record)
+}
+
+// Record is a single document returned by a search
+type Record struct {
+	ID     string                 `json:"_id"`
+	Source map[string]interface{} `json:"_source"`
+}
+
+// Decode fills the Model with the ID and fields of the Record
+func (r Record) Decode(m Model) error {
+	reflect.ValueOf(m).Elem().FieldByName("ID").SetString(r.ID)
+	return decodeRecord(m, r.Source)
+}
+
+// Search runs an Elastic query against the index of the Model and returns
+// the matching records.
+func (db *DB) Search(m Model, query interface{}) ([]Record, error) {
+	jsonbytes, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := postRequest(createURL(db.URL, []string{m.Index(), "_search"}), jsonbytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, response.Body)
+		return nil, errors.New("Could not search index " + m.Index())
+	}
+
+	var dbResponse struct {
+		Hits struct {
+			Hits []Record `json:"hits"`
+		} `json:"hits"`
+	}
+	jsonResponse(response, &dbResponse)
+
+	return dbResponse.Hits.Hits, nil
+}
+
+// DeleteByQuery deletes the records in the index of the Model that match an
+// Elastic query and returns how many were deleted
+func (db *DB) DeleteByQuery(m Model, query interface{}) (int, error) {
+	jsonbytes, err := json.Marshal(query)
+	if err != nil {
+		return 0, err
+	}
+
+	response, err := postRequest(createURL(db.URL, []string{m.Index(), "_delete_by_query"}), jsonbytes)
+	if err != nil {
+		return 0, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, response.Body)
+		return 0, errors.New("Could not delete from index " + m.Index())
+	}
+
+	var dbResponse struct {
+		Deleted int `json:"deleted"`
+	}
+	jsonResponse(response, &dbResponse)
+
+	return dbResponse.Deleted, nil
+}
+
+func encodeRecord(m Model) ([]byte, error) {
+	val := reflect.ValueOf(m).Elem()
+	record := map[string]interface{}{}
+
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		tags := strings.Split(field.Tag.Get("db"), ";")
+		name, _ := tags[0], tags[1:]
+
+		if name == "" {
+			name = field.Name
+		}
+		if name == "-" {
+			continue
+		}
+
+		record[name] = val.Field(i).Interface()
+	}
+
+	return json.Marshal(record)
+}
+
+func decodeRecord(m Model, record map[string]interface{}) error {
+	var err error
 	modelElem := reflect.ValueOf(m).Elem()
 
 	for i := 0; i < modelElem.NumField(); i++ {
@@ -265,6 +419,9 @@ func (db *DB) Get(m Model) error {
 		if name == "" {
 			name = field.Name
 		}
+		if name == "-" {
+			continue
+		}
 
 		if recordVal, ok := record[name]; ok {
 			if recordVal == nil {
@@ -302,6 +459,16 @@ func (db *DB) Get(m Model) error {
 					}
 				}
 				modelElem.Field(i).Set(reflect.ValueOf(recordVal.(time.Time)))
+			default:
+				// Maps, slices and structs come back as generic JSON values
+				// so let encoding/json do the conversion
+				jsonbytes, err := json.Marshal(recordVal)
+				if err != nil {
+					return err
+				}
+				if err := json.Unmarshal(jsonbytes, modelElem.Field(i).Addr().Interface()); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/syntaqx/go-chi-render"
+)
+
+// maxCiphertextLength is the longest encoded ciphertext an encrypted link
+// can have
+const maxCiphertextLength = 8192
+
+// ciphertextOverhead is the nonce and authentication tag AES-GCM adds to the
+// encrypted URL. Clients send the 12 byte nonce followed by the sealed URL,
+// encoded as unpadded base64url, and put the raw AES key encoded the same
+// way in the fragment of the link they share.
+const ciphertextOverhead = 12 + 16
+
+// IsEncrypted tells you if the destination of the link was encrypted by the
+// client. The key to decrypt it is never sent to us.
+func (link *Link) IsEncrypted() bool {
+	return link.Ciphertext != ""
+}
+
+// bindEncrypted validates the ciphertext of an encrypted link. All we can
+// check is that it is well formed, so settings that need to know the
+// destination can not be used.
+func (link *Link) bindEncrypted() error {
+	if len(link.Ciphertext) > maxCiphertextLength {
+		return errors.New("Ciphertext can be at most " + strconv.Itoa(maxCiphertextLength) + " characters")
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(link.Ciphertext)
+	if err != nil {
+		return errors.New("Ciphertext must be unpadded base64url")
+	}
+	if len(decoded) <= ciphertextOverhead {
+		return errors.New("Ciphertext is too short")
+	}
+	if link.URL != "" || link.Content != "" || link.Format != "" ||
+		len(link.Variants) > 0 || len(link.Rules) > 0 || link.FallbackURL != "" {
+		return errors.New("Encrypted links can not have other destinations")
+	}
+	if link.ForwardPath || link.ForwardQuery || len(link.Campaign) > 0 || link.QueryMerge != "" {
+		return errors.New("Encrypted links can not change their destination")
+	}
+	return nil
+}
+
+// showEncrypted counts a visit of the encrypted link and renders the page
+// that decrypts its destination in the browser
+func showEncrypted(w http.ResponseWriter, r *http.Request, link *Link) {
+	countHit(w, link, -1)
+	// Browsers never send the fragment on, but the page should not leak
+	// where it was opened either
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	render.Render(w, WithTemplate(r, "link.decrypt"), link)
+}
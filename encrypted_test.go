@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// encryptURL seals a URL the way the browser does for encrypted links
+func encryptURL(t *testing.T, key []byte, rawurl string) string {
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	nonce := make([]byte, gcm.NonceSize())
+	return base64.RawURLEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(rawurl), nil))
+}
+
+func TestBindEncrypted(t *testing.T) {
+	require := require.New(t)
+
+	ciphertext := encryptURL(t, make([]byte, 32), "https://example.com/secret")
+
+	link := &Link{Ciphertext: ciphertext}
+	require.NoError(link.bindEncrypted())
+
+	link = &Link{Ciphertext: ciphertext + "="}
+	require.Error(link.bindEncrypted())
+
+	link = &Link{Ciphertext: "c2hvcnQ"}
+	require.Error(link.bindEncrypted())
+
+	link = &Link{Ciphertext: strings.Repeat("a", maxCiphertextLength+1)}
+	require.Error(link.bindEncrypted())
+
+	link = &Link{Ciphertext: ciphertext, URL: "https://example.com/"}
+	require.Error(link.bindEncrypted())
+
+	link = &Link{Ciphertext: ciphertext, ForwardQuery: true}
+	require.Error(link.bindEncrypted())
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// GeoIP looks up the country of IP addresses in a locally stored database in
+// the MaxMind DB format, such as GeoLite2 Country. The file is read again when
+// it changes.
+type GeoIP struct {
+	Path string
+
+	file *watchedFile
+}
+
+// NewGeoIP loads the GeoIP database at the given path
+func NewGeoIP(path string) (*GeoIP, error) {
+	file, err := watchFile(path, func(file *os.File) (interface{}, error) {
+		buffer, err := ioutil.ReadAll(file)
+		if err != nil {
+			return nil, err
+		}
+		return newMMDBReader(buffer)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &GeoIP{Path: path, file: file}, nil
+}
+
+// Country returns the ISO 3166-1 code of the country of the IP address, or
+// an empty string if it is unknown. A nil GeoIP knows no countries.
+func (geo *GeoIP) Country(ip net.IP) string {
+	if geo == nil || ip == nil {
+		return ""
+	}
+	reader := geo.file.Value().(*mmdbReader)
+
+	record, err := reader.Lookup(ip)
+	if err != nil {
+		return ""
+	}
+	for _, key := range []string{"country", "registered_country"} {
+		country, _ := record[key].(map[string]interface{})
+		if code, ok := country["iso_code"].(string); ok {
+			return code
+		}
+	}
+	return ""
+}
+
+// clientIP returns the address of the visitor. X-Forwarded-For is only
+// believed when the request comes from one of the trusted proxies, in which
+// case the last address before the trusted proxies is used.
+func clientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !inNetworks(trusted, ip) {
+		return ip
+	}
+
+	var forwarded []string
+	for _, header := range r.Header["X-Forwarded-For"] {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !inNetworks(trusted, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// parseNetworks parses a list of CIDR ranges. Plain addresses are taken as
+// ranges with only that address.
+func parseNetworks(list []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, errors.New("Invalid IP address " + s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func inNetworks(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// mmdbMetadataStart marks the start of the metadata at the end of a MaxMind
+// DB file
+var mmdbMetadataStart = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbReader reads the search tree and data section of a MaxMind DB file as
+// described in https://maxmind.github.io/MaxMind-DB/
+type mmdbReader struct {
+	buffer     []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+	data       []byte
+}
+
+func newMMDBReader(buffer []byte) (*mmdbReader, error) {
+	start := bytes.LastIndex(buffer, mmdbMetadataStart)
+	if start < 0 {
+		return nil, errors.New("Invalid MaxMind DB file")
+	}
+	metadata := buffer[start+len(mmdbMetadataStart):]
+	value, _, err := (&mmdbDecoder{metadata}).decode(0)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Invalid MaxMind DB metadata")
+	}
+	nodeCount, _ := fields["node_count"].(uint64)
+	recordSize, _ := fields["record_size"].(uint64)
+	ipVersion, _ := fields["ip_version"].(uint64)
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return nil, errors.New("Unsupported MaxMind DB record size")
+	}
+
+	reader := &mmdbReader{
+		buffer:     buffer,
+		nodeCount:  uint(nodeCount),
+		recordSize: uint(recordSize),
+		ipVersion:  uint(ipVersion),
+	}
+	treeSize := reader.nodeCount * reader.recordSize / 4
+	if treeSize+16 > uint(start) {
+		return nil, errors.New("Invalid MaxMind DB search tree")
+	}
+	reader.data = buffer[treeSize+16 : start]
+
+	// IPv4 addresses are stored under ::/96 in IPv6 databases
+	if reader.ipVersion == 6 {
+		for i := 0; i < 96 && reader.ipv4Start < reader.nodeCount; i++ {
+			reader.ipv4Start = reader.record(reader.ipv4Start, 0)
+		}
+	}
+	return reader, nil
+}
+
+// record returns the left (0) or right (1) record of a node
+func (reader *mmdbReader) record(node uint, bit uint) uint {
+	b := reader.buffer[node*reader.recordSize/4:]
+	switch reader.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// Lookup returns the record for the IP address, or nil if there is none
+func (reader *mmdbReader) Lookup(ip net.IP) (map[string]interface{}, error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		node = reader.ipv4Start
+	} else if reader.ipVersion == 4 {
+		return nil, nil
+	}
+
+	for i := 0; i < len(ip)*8 && node < reader.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = reader.record(node, bit)
+	}
+	if node <= reader.nodeCount {
+		return nil, nil
+	}
+
+	offset := node - reader.nodeCount - 16
+	if offset >= uint(len(reader.data)) {
+		return nil, errors.New("Invalid MaxMind DB pointer")
+	}
+	value, _, err := (&mmdbDecoder{reader.data}).decode(offset)
+	if err != nil {
+		return nil, err
+	}
+	record, _ := value.(map[string]interface{})
+	return record, nil
+}
+
+// mmdbDecoder decodes values of the MaxMind DB data section format
+type mmdbDecoder struct {
+	buffer []byte
+}
+
+const (
+	mmdbPointer   = 1
+	mmdbString    = 2
+	mmdbDouble    = 3
+	mmdbBytes     = 4
+	mmdbUint16    = 5
+	mmdbUint32    = 6
+	mmdbMap       = 7
+	mmdbInt32     = 8
+	mmdbUint64    = 9
+	mmdbUint128   = 10
+	mmdbArray     = 11
+	mmdbContainer = 12
+	mmdbEnd       = 13
+	mmdbBool      = 14
+	mmdbFloat     = 15
+)
+
+var errInvalidMMDBData = errors.New("Invalid MaxMind DB data")
+
+// decode returns the value at the offset and the offset after it
+func (d *mmdbDecoder) decode(offset uint) (interface{}, uint, error) {
+	if offset >= uint(len(d.buffer)) {
+		return nil, 0, errInvalidMMDBData
+	}
+	control := d.buffer[offset]
+	offset++
+
+	kind := uint(control >> 5)
+	if kind == mmdbPointer {
+		pointer, next, err := d.pointer(control, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer)
+		return value, next, err
+	}
+	if kind == 0 {
+		if offset >= uint(len(d.buffer)) {
+			return nil, 0, errInvalidMMDBData
+		}
+		kind = 7 + uint(d.buffer[offset])
+		offset++
+	}
+
+	size := uint(control & 0x1F)
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(d.buffer)) {
+			return nil, 0, errInvalidMMDBData
+		}
+		n := uint(0)
+		for _, b := range d.buffer[offset : offset+extra] {
+			n = n<<8 | uint(b)
+		}
+		offset += extra
+		switch extra {
+		case 1:
+			size = 29 + n
+		case 2:
+			size = 285 + n
+		default:
+			size = 65821 + n
+		}
+	}
+
+	switch kind {
+	case mmdbMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			value, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errInvalidMMDBData
+			}
+			m[name] = value
+			offset = next
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	case mmdbContainer, mmdbEnd:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buffer)) {
+		return nil, 0, errInvalidMMDBData
+	}
+	b := d.buffer[offset : offset+size]
+	offset += size
+
+	switch kind {
+	case mmdbString:
+		return string(b), offset, nil
+	case mmdbBytes:
+		return append([]byte{}, b...), offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errInvalidMMDBData
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errInvalidMMDBData
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbInt32:
+		if size > 8 {
+			return nil, 0, errInvalidMMDBData
+		}
+		n := uint64(0)
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		if kind == mmdbInt32 {
+			return int64(int32(uint32(n))), offset, nil
+		}
+		return n, offset, nil
+	case mmdbUint128:
+		// Too big for the values needed here, so keep the raw bytes
+		return append([]byte{}, b...), offset, nil
+	}
+	return nil, 0, errInvalidMMDBData
+}
+
+// pointer decodes a pointer whose control byte has already been read
+func (d *mmdbDecoder) pointer(control byte, offset uint) (uint, uint, error) {
+	size := uint(control>>3) & 0x3
+	if offset+size+1 > uint(len(d.buffer)) {
+		return 0, 0, errInvalidMMDBData
+	}
+	b := d.buffer[offset : offset+size+1]
+
+	pointer := uint(0)
+	if size < 3 {
+		pointer = uint(control & 0x7)
+	}
+	for _, c := range b {
+		pointer = pointer<<8 | uint(c)
+	}
+	switch size {
+	case 1:
+		pointer += 2048
+	case 2:
+		pointer += 526336
+	}
+	return pointer, offset + size + 1, nil
+}
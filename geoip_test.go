@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fixtures/geoip/country.mmdb has 81.2.69.0/24 in GB, 89.160.20.0/24 in SE
+// and 2001:218::/32 in JP
+func TestGeoIPCountry(t *testing.T) {
+	require := require.New(t)
+
+	geo, err := NewGeoIP("fixtures/geoip/country.mmdb")
+	require.NoError(err)
+
+	require.Equal("GB", geo.Country(net.ParseIP("81.2.69.142")))
+	require.Equal("GB", geo.Country(net.ParseIP("::ffff:81.2.69.1")))
+	require.Equal("SE", geo.Country(net.ParseIP("89.160.20.112")))
+	require.Equal("JP", geo.Country(net.ParseIP("2001:218:85a3::1")))
+	require.Equal("", geo.Country(net.ParseIP("81.2.70.1")))
+	require.Equal("", geo.Country(net.ParseIP("2001:db8::1")))
+
+	var none *GeoIP
+	require.Equal("", none.Country(net.ParseIP("81.2.69.142")))
+}
+
+func TestClientIP(t *testing.T) {
+	require := require.New(t)
+
+	trusted, err := parseNetworks([]string{"10.0.0.0/8", "192.0.2.1"})
+	require.NoError(err)
+
+	r, err := http.NewRequest("GET", "/", nil)
+	require.NoError(err)
+	r.RemoteAddr = "198.51.100.7:1234"
+	r.Header.Set("X-Forwarded-For", "81.2.69.142")
+	require.Equal("198.51.100.7", clientIP(r, trusted).String())
+
+	r.RemoteAddr = "10.1.2.3:1234"
+	r.Header.Set("X-Forwarded-For", "1.1.1.1, 81.2.69.142, 192.0.2.1")
+	require.Equal("81.2.69.142", clientIP(r, trusted).String())
+
+	r.Header.Set("X-Forwarded-For", "10.0.0.2")
+	require.Equal("10.0.0.2", clientIP(r, trusted).String())
+
+	r.Header.Del("X-Forwarded-For")
+	require.Equal("10.1.2.3", clientIP(r, trusted).String())
+
+	_, err = parseNetworks([]string{"not an address"})
+	require.Error(err)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// InterstitialPolicy decides which links show the destination on a page of
+// their own before visitors are sent there
+type InterstitialPolicy struct {
+	// Domains are destinations that always get an interstitial. Entries may
+	// contain wildcards such as `*.example.com`.
+	Domains []string
+	// External shows an interstitial for every destination that is not on
+	// one of our own hosts
+	External bool
+	// NewerThan shows an interstitial for links created less than this long
+	// ago, 0 turns it off
+	NewerThan time.Duration
+	// Anonymous shows an interstitial for links created without an API key
+	Anonymous bool
+	// Countdown is how many seconds the interstitial waits before it sends
+	// visitors on by itself, 0 waits for them to continue
+	Countdown int
+}
+
+// Needs tells you if visitors of the link have to pass an interstitial
+// before they are sent to the destination. hosts are our own hosts.
+func (p *InterstitialPolicy) Needs(link *Link, destination string, hosts []string, now time.Time) bool {
+	if link.Interstitial {
+		return true
+	}
+	if p.Anonymous && link.Owner == "" {
+		return true
+	}
+	if p.NewerThan > 0 && now.Sub(link.Timestamp) < p.NewerThan {
+		return true
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return true
+	}
+	if p.External && !isOwnHost(u, hosts) {
+		return true
+	}
+	host, err := asciiHostname(strings.TrimSuffix(u.Hostname(), "."))
+	if err != nil {
+		return true
+	}
+	return matchDomain(p.Domains, host)
+}
+
+// Interstitial is rendered in place of a redirect that visitors have to
+// confirm. It counts as a hit of the link, whether visitors continue or not.
+type Interstitial struct {
+	*Link
+	Countdown int `json:"countdown,omitempty"`
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterstitialPolicyNeeds(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Now()
+	hosts := []string{"sho.rt"}
+	link := &Link{Owner: "alice", Timestamp: now.Add(-48 * time.Hour)}
+
+	policy := &InterstitialPolicy{}
+	require.False(policy.Needs(link, "https://example.com/", hosts, now))
+	require.True(policy.Needs(&Link{Interstitial: true}, "https://example.com/", hosts, now))
+
+	policy = &InterstitialPolicy{Domains: []string{"*.example.org"}}
+	require.True(policy.Needs(link, "https://www.example.org/", hosts, now))
+	require.False(policy.Needs(link, "https://example.com/", hosts, now))
+
+	policy = &InterstitialPolicy{External: true}
+	require.True(policy.Needs(link, "https://example.com/", hosts, now))
+	require.False(policy.Needs(link, "https://sho.rt/other", hosts, now))
+
+	policy = &InterstitialPolicy{NewerThan: 24 * time.Hour}
+	require.False(policy.Needs(link, "https://example.com/", hosts, now))
+	require.True(policy.Needs(&Link{Owner: "alice", Timestamp: now.Add(-time.Hour)}, "https://example.com/", hosts, now))
+
+	policy = &InterstitialPolicy{Anonymous: true}
+	require.False(policy.Needs(link, "https://example.com/", hosts, now))
+	require.True(policy.Needs(&Link{Timestamp: link.Timestamp}, "https://example.com/", hosts, now))
+}
@@ -6,6 +6,8 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,40 +15,339 @@ import (
 type Link struct {
 	ID  string `json:"id" form:"id"`
 	URL string `json:"url" form:"url,omitempty" db:"url;type:text;analyzer:standard"`
+	// OriginalURL is the URL exactly as it was given before canonicalisation
+	OriginalURL string `json:"original_url,omitempty" form:"-" db:"original_url;type:keyword"`
+	// NormalizedURL is used to look up links that point to the same place
+	NormalizedURL string `json:"-" form:"-" db:"normalized_url;type:keyword"`
+
+	Title       string `json:"title,omitempty" form:"title,omitempty" db:"title;type:text"`
+	Description string `json:"description,omitempty" form:"description,omitempty" db:"description;type:text"`
+	// Notes are free-form notes for the owners of the link, they are not
+	// shown to visitors
+	Notes string   `json:"notes,omitempty" form:"notes,omitempty" db:"notes;type:text"`
+	Tags  []string `json:"tags,omitempty" form:"tags,omitempty" db:"tags;type:keyword"`
+	// Content makes the link a paste that shows this text instead of
+	// redirecting
+	Content string `json:"content,omitempty" form:"content,omitempty" db:"content;type:text"`
+	// Format of the Content, either "text" (the default) or "markdown"
+	Format string `json:"format,omitempty" form:"format,omitempty" db:"format;type:keyword"`
+
+	// Ciphertext is the destination encrypted by the client, which is
+	// decrypted in the browser with the key from the URL fragment
+	Ciphertext string `json:"ciphertext,omitempty" form:"ciphertext,omitempty" db:"ciphertext;type:keyword"`
+
+	// Items make the link a collection page that lists them
+	Items []CollectionItem `json:"items,omitempty" form:"items,omitempty" db:"items;type:object"`
+
+	// Interstitial makes visitors confirm the destination on a page of its
+	// own before they are sent there
+	Interstitial bool `json:"interstitial,omitempty" form:"interstitial,omitempty" db:"interstitial;type:boolean"`
+
+	// Aliases are other IDs the link can be reached under
+	Aliases []string `json:"aliases,omitempty" form:"aliases,omitempty" db:"aliases;type:keyword"`
+
+	// Password is only used to set a new password, it is stored as
+	// PasswordHash and never returned
+	Password     string `json:"password,omitempty" form:"password,omitempty" db:"-"`
+	PasswordHash string `json:"-" form:"-" db:"password_hash;type:keyword"`
 
 	HitCount int64     `json:"-" form:"-" db:"hit_count;type:long"`
 	HitLimit int64     `json:"limit,omitempty" form:"limit,omitempty" db:"hit_limit;type:long"`
 	Expires  time.Time `json:"expires,omitempty" form:"expires,omitempty" db:"expires;type:date"`
+	// NotBefore is when the link becomes active
+	NotBefore time.Time `json:"not_before,omitempty" form:"not_before,omitempty" db:"not_before;type:date"`
+	// FallbackURL is where visitors are sent once the link has expired or
+	// reached its hit limit
+	FallbackURL string `json:"fallback_url,omitempty" form:"fallback_url,omitempty" db:"fallback_url;type:keyword"`
+	// RedirectStatus is the status code used to redirect, 302 by default
+	RedirectStatus int64 `json:"redirect_status,omitempty" form:"redirect_status,omitempty" db:"redirect_status;type:long"`
+	// CacheMaxAge is how many seconds browsers may cache the redirect for
+	CacheMaxAge    int64  `json:"cache_max_age,omitempty" form:"cache_max_age,omitempty" db:"cache_max_age;type:long"`
+	ReferrerPolicy string `json:"referrer_policy,omitempty" form:"referrer_policy,omitempty" db:"referrer_policy;type:keyword"`
+	// ForwardPath appends any path after the ID in the request to the
+	// destination
+	ForwardPath bool `json:"forward_path,omitempty" form:"forward_path,omitempty" db:"forward_path;type:boolean"`
+	// ForwardQuery adds the query parameters of the request to the
+	// destination
+	ForwardQuery bool `json:"forward_query,omitempty" form:"forward_query,omitempty" db:"forward_query;type:boolean"`
+	// QueryMerge decides what happens to forwarded parameters that are
+	// already in the destination: "link" keeps the destination's value (the
+	// default), "request" replaces it and "append" keeps both.
+	QueryMerge string `json:"query_merge,omitempty" form:"query_merge,omitempty" db:"query_merge;type:keyword"`
+	// Rules send visitors to other destinations depending on their platform,
+	// language, country or the time of day. The first matching rule is used.
+	Rules []Rule `json:"rules,omitempty" form:"rules,omitempty" db:"rules;type:object"`
+	// Variants are destinations that are picked at random by weight instead
+	// of URL. Every visitor keeps getting the same variant. URL is always
+	// set to the first variant.
+	Variants []Variant `json:"variants,omitempty" form:"variants,omitempty" db:"variants;type:object"`
+	// Campaign are parameters such as `utm_source` that are added to the
+	// destination when redirecting. They are not indexed, since every
+	// parameter name would add a field to the mapping.
+	Campaign map[string]string `json:"campaign,omitempty" form:"campaign,omitempty" db:"campaign;type:object;enabled:false"`
+	// ExpiresIn sets Expires relative to now, e.g. "24h" or "7d"
+	ExpiresIn string `json:"expires_in,omitempty" form:"expires_in,omitempty" db:"-"`
+	// Once makes the link expire after it has been used once
+	Once bool `json:"once,omitempty" form:"once,omitempty" db:"-"`
+	// ExpiresAfterIdle keeps moving Expires forward so that the link expires
+	// when it has not been used for this long, e.g. "30d"
+	ExpiresAfterIdle string    `json:"expires_after_idle,omitempty" form:"expires_after_idle,omitempty" db:"expires_after_idle;type:keyword"`
+	LastHit          time.Time `json:"-" form:"-" db:"last_hit;type:date"`
+
+	// Disabled links are kept but not followed until they are enabled again
+	Disabled bool `json:"disabled,omitempty" form:"disabled,omitempty" db:"disabled;type:boolean"`
+	// DeletedAt is when the link was moved to the trash, see purgeTrash
+	DeletedAt *time.Time `json:"deleted_at,omitempty" form:"-" db:"deleted_at;type:date"`
+
+	// Owner is who created the link with an API key, empty for anonymous
+	// links
+	Owner string `json:"owner,omitempty" form:"-" db:"owner;type:keyword"`
 
 	// TODO: Rename this? This is the created time.
 	Timestamp time.Time `json:"@timestamp" form:"@timestamp" db:"@timestamp;type:date"`
+	// UpdatedAt is when the link was last changed
+	UpdatedAt time.Time `json:"updated_at,omitempty" form:"-" db:"updated_at;type:date"`
 }
 
 func (link *Link) String() string {
-	return link.URL
+	if link.IsPaste() {
+		return link.Content
+	}
+	if link.IsEncrypted() {
+		return link.Ciphertext
+	}
+	if link.IsCollection() {
+		lines := make([]string, len(link.Items))
+		for i, item := range link.Items {
+			lines[i] = item.String()
+		}
+		return strings.Join(lines, "\n")
+	}
+	if len(link.Variants) == 0 {
+		return link.URL
+	}
+	lines := make([]string, len(link.Variants))
+	for i, variant := range link.Variants {
+		lines[i] = variant.String()
+	}
+	return strings.Join(lines, "\n")
 }
 
 // Render is a `go-chi` middleware
 func (link *Link) Render(w http.ResponseWriter, r *http.Request) error {
-	// Make sure we omit the hit limit in any response
+	// Make sure we omit the hit limit and password in any response
 	link.HitLimit = 0
+	link.Password = ""
+
+	// and what is only meant for the owner in responses to anyone else
+	if owner, err := requestOwner(r); err != nil || owner != link.Owner {
+		link.Notes = ""
+		link.Owner = ""
+	}
 	return nil
 }
 
 func (link *Link) Bind(r *http.Request) error {
-	if link.URL == "" {
+	// Only DELETE moves links to the trash
+	link.DeletedAt = nil
+	// and only the server decides when links were created or changed
+	link.Timestamp = time.Time{}
+	link.UpdatedAt = time.Time{}
+
+	// The first variant is the destination that previews, deduplication
+	// and the destination checks look at
+	if len(link.Variants) > 0 {
+		link.URL = link.Variants[0].URL
+	}
+	if link.IsCollection() {
+		if err := link.bindCollection(); err != nil {
+			return err
+		}
+	} else if link.IsEncrypted() {
+		if err := link.bindEncrypted(); err != nil {
+			return err
+		}
+	} else if link.IsPaste() {
+		if err := link.bindPaste(); err != nil {
+			return err
+		}
+	} else if link.URL == "" {
 		return errors.New("Malformed URL")
 	}
-	url, err := url.Parse(link.URL)
-	if err != nil {
+
+	switch link.RedirectStatus {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return errors.New("Redirect status must be 301, 302, 307 or 308")
+	}
+	if link.CacheMaxAge < 0 {
+		return errors.New("Cache max age can not be negative")
+	}
+	if link.ReferrerPolicy != "" && !referrerPolicies[link.ReferrerPolicy] {
+		return errors.New("Unknown referrer policy " + link.ReferrerPolicy)
+	}
+
+	switch link.QueryMerge {
+	case "", "link", "request", "append":
+	default:
+		return errors.New("Query merge must be link, request or append")
+	}
+
+	if err := validateCampaign(link.Campaign); err != nil {
 		return err
 	}
-	if url.Host == "" || url.Scheme == "" {
-		return errors.New("Malformed URL")
+
+	if link.ExpiresIn != "" && !link.Expires.IsZero() {
+		return errors.New("Only one of expires and expires_in can be set")
+	}
+	if link.ExpiresAfterIdle != "" && (link.ExpiresIn != "" || !link.Expires.IsZero()) {
+		return errors.New("Expires after idle can't be combined with expires or expires_in")
+	}
+	for _, duration := range []string{link.ExpiresIn, link.ExpiresAfterIdle} {
+		if duration == "" {
+			continue
+		}
+		if _, err := parseDuration(duration); err != nil {
+			return err
+		}
+	}
+
+	if !link.IsPaste() && !link.IsEncrypted() && !link.IsCollection() {
+		canonical, err := checkDestination(link.URL)
+		if err != nil {
+			return err
+		}
+		link.OriginalURL = link.URL
+		link.URL = canonical
+	}
+
+	if link.FallbackURL != "" {
+		if isTemplate(link.FallbackURL) {
+			return errors.New("Fallback URL can not have placeholders")
+		}
+		var err error
+		link.FallbackURL, err = checkDestination(link.FallbackURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := link.bindMetadata(); err != nil {
+		return err
+	}
+	if err := link.bindAliases(); err != nil {
+		return err
+	}
+	if err := link.bindRules(); err != nil {
+		return err
 	}
+	if err := link.bindVariants(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// checkDestination makes sure a URL given for a link is well formed and
+// allowed and returns its canonical form
+func checkDestination(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" || u.Scheme == "" {
+		return "", errors.New("Malformed URL")
+	}
+
+	canonicalize, example := canonicalURL, func(s string) string { return s }
+	if isTemplate(rawurl) {
+		canonicalize, example = canonicalTemplate, exampleTemplate
+	}
+	canonical, err := canonicalize(rawurl, config.StripTracking)
+	if err != nil {
+		return "", err
+	}
+	if err := config.Policy.Check(example(canonical)); err != nil {
+		return "", err
+	}
+	if config.ThreatAction == "block" && threats.Match(example(canonical)) {
+		return "", errors.New("URL is flagged as unsafe")
+	}
+	return canonical, nil
+}
+
+// Destination returns the URL to redirect to for a request with the given
+// path after the link ID and query parameters, starting from base which is
+// the URL of the link or one of its variants. The path and query are only
+// forwarded if the link allows it.
+func (link *Link) Destination(base string, extraPath string, query url.Values) (string, error) {
+	if !(link.ForwardPath && extraPath != "") && !(link.ForwardQuery && len(query) > 0) {
+		return base, nil
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	if link.ForwardPath && extraPath != "" {
+		path := strings.TrimSuffix(u.EscapedPath(), "/")
+		// Resolving dot segments on their own keeps the forwarded path from
+		// climbing out of the destination path
+		extraPath = strings.TrimPrefix(removeDotSegments("/"+extraPath), "/")
+		for _, segment := range strings.Split(extraPath, "/") {
+			path += "/" + url.PathEscape(segment)
+		}
+		u.Path, err = url.PathUnescape(path)
+		if err != nil {
+			return "", err
+		}
+		u.RawPath = path
+	}
+
+	if link.ForwardQuery && len(query) > 0 {
+		values := u.Query()
+		for name, value := range query {
+			_, exists := values[name]
+			switch {
+			case !exists:
+				values[name] = value
+			case link.QueryMerge == "request":
+				values[name] = value
+			case link.QueryMerge == "append":
+				values[name] = append(values[name], value...)
+			}
+		}
+		u.RawQuery = values.Encode()
+	}
+
+	return u.String(), nil
+}
+
+var referrerPolicies = map[string]bool{
+	"no-referrer":                     true,
+	"no-referrer-when-downgrade":      true,
+	"origin":                          true,
+	"origin-when-cross-origin":        true,
+	"same-origin":                     true,
+	"strict-origin":                   true,
+	"strict-origin-when-cross-origin": true,
+	"unsafe-url":                      true,
+}
+
+// redirectStatus returns the status code to redirect the request with.
+// Passwords are submitted with a POST which must not be repeated against
+// the destination, so those always get a 303.
+func (link *Link) redirectStatus(r *http.Request) int {
+	if r.Method == http.MethodPost {
+		return http.StatusSeeOther
+	}
+	if link.RedirectStatus == 0 {
+		return http.StatusFound
+	}
+	return int(link.RedirectStatus)
+}
+
 // Index returns the Elastic index name
 func (link *Link) Index() string {
 	return "links"
@@ -62,28 +363,152 @@ func (link *Link) GenerateID() error {
 	return nil
 }
 
-// Prepare makes sure that the Link has a ID and a Timestamp
+// Prepare makes sure that the Link has a ID and a Timestamp and turns
+// relative expiry settings into an Expires time
 func (link *Link) Prepare() error {
 	if link.Timestamp.IsZero() {
 		link.Timestamp = time.Now()
 	}
 
+	if link.ExpiresIn != "" {
+		duration, err := parseDuration(link.ExpiresIn)
+		if err != nil {
+			return err
+		}
+		link.Expires = time.Now().Add(duration)
+		link.ExpiresIn = ""
+	}
+
+	if link.Once {
+		link.HitLimit = 1
+		link.Once = false
+	}
+
+	if link.ExpiresAfterIdle != "" {
+		duration, err := parseDuration(link.ExpiresAfterIdle)
+		if err != nil {
+			return err
+		}
+		lastUsed := link.LastHit
+		if lastUsed.IsZero() {
+			lastUsed = link.Timestamp
+		}
+		link.Expires = lastUsed.Add(duration)
+	}
+
+	if link.Password != "" {
+		hash, err := hashPassword(link.Password)
+		if err != nil {
+			return err
+		}
+		link.PasswordHash = hash
+		link.Password = ""
+	}
+
+	if link.URL != "" {
+		normalized, err := normalizeURL(link.URL)
+		if err != nil {
+			return err
+		}
+		link.NormalizedURL = normalized
+	}
+
 	return nil
 }
 
-// CanRead tells you if you can read this object
-func (link *Link) CanRead() bool {
-	if link.HitLimit == 0 && link.Expires.IsZero() {
-		return true
+// Reasons why a link can not be read
+var (
+	ErrNotActive = errors.New("Link is not active yet")
+	ErrExpired   = errors.New("Link has expired")
+	ErrExhausted = errors.New("Link has reached its hit limit")
+	ErrDisabled  = errors.New("Link is disabled")
+	ErrDeleted   = errors.New("Link is in the trash")
+)
+
+// CanRead tells you if you can read this object. It returns nil if you can
+// and otherwise the reason why not.
+func (link *Link) CanRead() error {
+	if link.DeletedAt != nil {
+		return ErrDeleted
+	}
+
+	if link.Disabled {
+		return ErrDisabled
+	}
+
+	if !link.NotBefore.IsZero() && link.NotBefore.After(time.Now()) {
+		return ErrNotActive
 	}
 
 	if link.HitLimit > 0 && link.HitCount >= link.HitLimit {
-		return false
+		return ErrExhausted
 	}
 
 	if !link.Expires.IsZero() && link.Expires.Before(time.Now()) {
-		return false
+		return ErrExpired
 	}
 
-	return true
+	return nil
+}
+
+// HasOptions tells you if the link was given any settings or metadata
+// besides the URL
+func (link *Link) HasOptions() bool {
+	return link.HitLimit != 0 || !link.Expires.IsZero() || !link.NotBefore.IsZero() ||
+		link.ExpiresIn != "" || link.Once || link.ExpiresAfterIdle != "" ||
+		link.ForwardPath || link.ForwardQuery || link.QueryMerge != "" || len(link.Campaign) > 0 ||
+		len(link.Rules) > 0 || len(link.Variants) > 0 ||
+		link.FallbackURL != "" || link.RedirectStatus != 0 || link.CacheMaxAge != 0 || link.ReferrerPolicy != "" ||
+		link.Password != "" || link.PasswordHash != "" ||
+		link.Title != "" || link.Description != "" || link.Notes != "" || len(link.Tags) > 0 ||
+		len(link.Aliases) > 0 || link.IsPaste() || link.IsEncrypted() ||
+		link.IsCollection() || link.Interstitial
+}
+
+// normalizeURL returns the form of a URL that is used to find duplicates
+func normalizeURL(rawurl string) (string, error) {
+	return canonicalURL(rawurl, config.StripTracking)
+}
+
+// parseDuration is like time.ParseDuration but also understands days ("d")
+// and weeks ("w"), e.g. "7d" or "1w2d12h"
+func parseDuration(s string) (time.Duration, error) {
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		i := 0
+		for i < len(rest) && (rest[i] == '.' || (rest[i] >= '0' && rest[i] <= '9')) {
+			i++
+		}
+		j := i
+		for j < len(rest) && !(rest[j] == '.' || (rest[j] >= '0' && rest[j] <= '9')) {
+			j++
+		}
+		number, unit := rest[:i], rest[i:j]
+		rest = rest[j:]
+
+		var day float64
+		switch unit {
+		case "d":
+			day = 1
+		case "w":
+			day = 7
+		default:
+			duration, err := time.ParseDuration(number + unit)
+			if err != nil {
+				return 0, errors.New("Invalid duration " + s)
+			}
+			total += duration
+			continue
+		}
+		n, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return 0, errors.New("Invalid duration " + s)
+		}
+		total += time.Duration(n * day * float64(24*time.Hour))
+	}
+	if total <= 0 {
+		return 0, errors.New("Invalid duration " + s)
+	}
+	return total, nil
 }
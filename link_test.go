@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkCanRead(t *testing.T) {
+	require := require.New(t)
+
+	hour := time.Hour
+	link := &Link{URL: "https://example.com"}
+	require.NoError(link.CanRead())
+
+	link = &Link{URL: "https://example.com", NotBefore: time.Now().Add(hour)}
+	require.Equal(ErrNotActive, link.CanRead())
+
+	link = &Link{URL: "https://example.com", NotBefore: time.Now().Add(-hour), Expires: time.Now().Add(hour)}
+	require.NoError(link.CanRead())
+
+	link = &Link{URL: "https://example.com", Expires: time.Now().Add(-hour)}
+	require.Equal(ErrExpired, link.CanRead())
+
+	link = &Link{URL: "https://example.com", HitLimit: 2, HitCount: 2}
+	require.Equal(ErrExhausted, link.CanRead())
+
+	link = &Link{URL: "https://example.com", Disabled: true}
+	require.Equal(ErrDisabled, link.CanRead())
+
+	deleted := time.Now()
+	link = &Link{URL: "https://example.com", Disabled: true, DeletedAt: &deleted}
+	require.Equal(ErrDeleted, link.CanRead())
+}
+
+func TestParseDuration(t *testing.T) {
+	require := require.New(t)
+
+	tests := map[string]time.Duration{
+		"24h":     24 * time.Hour,
+		"90m":     90 * time.Minute,
+		"7d":      7 * 24 * time.Hour,
+		"1w":      7 * 24 * time.Hour,
+		"1d12h":   36 * time.Hour,
+		"1.5d":    36 * time.Hour,
+		"2w1d30m": 15*24*time.Hour + 30*time.Minute,
+	}
+	for s, expected := range tests {
+		duration, err := parseDuration(s)
+		require.NoError(err, s)
+		require.Equal(expected, duration, s)
+	}
+
+	for _, s := range []string{"", "7", "d", "-1d", "1y", "0h"} {
+		_, err := parseDuration(s)
+		require.Error(err, s)
+	}
+}
+
+func TestLinkPrepareRelativeExpiry(t *testing.T) {
+	require := require.New(t)
+
+	link := &Link{URL: "https://example.com", ExpiresIn: "7d"}
+	require.NoError(link.Prepare())
+	require.WithinDuration(time.Now().Add(7*24*time.Hour), link.Expires, time.Minute)
+	require.Equal("", link.ExpiresIn)
+
+	link = &Link{URL: "https://example.com", Once: true}
+	require.NoError(link.Prepare())
+	require.Equal(int64(1), link.HitLimit)
+
+	created := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	link = &Link{URL: "https://example.com", ExpiresAfterIdle: "30d", Timestamp: created}
+	require.NoError(link.Prepare())
+	require.Equal(created.Add(30*24*time.Hour), link.Expires)
+
+	link.LastHit = created.Add(24 * time.Hour)
+	require.NoError(link.Prepare())
+	require.Equal(created.Add(31*24*time.Hour), link.Expires)
+}
+
+func TestLinkDestination(t *testing.T) {
+	require := require.New(t)
+
+	link := &Link{URL: "https://example.com/docs/?lang=en"}
+	destination, err := link.Destination(link.URL, "api/v2", url.Values{"tab": {"auth"}})
+	require.NoError(err)
+	require.Equal("https://example.com/docs/?lang=en", destination)
+
+	link.ForwardPath = true
+	link.ForwardQuery = true
+	destination, err = link.Destination(link.URL, "api/../v2 beta", url.Values{"tab": {"auth"}, "lang": {"de"}})
+	require.NoError(err)
+	require.Equal("https://example.com/docs/v2%20beta?lang=en&tab=auth", destination)
+
+	link.QueryMerge = "request"
+	destination, err = link.Destination(link.URL, "", url.Values{"lang": {"de"}})
+	require.NoError(err)
+	require.Equal("https://example.com/docs/?lang=de", destination)
+
+	link.QueryMerge = "append"
+	destination, err = link.Destination(link.URL, "", url.Values{"lang": {"de"}})
+	require.NoError(err)
+	require.Equal("https://example.com/docs/?lang=en&lang=de", destination)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	markdownHeading    = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	markdownBullet     = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	markdownNumbered   = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	markdownQuote      = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	markdownRule       = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	markdownLink       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	markdownStrong     = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	markdownEmphasis   = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+	markdownLinkScheme = map[string]bool{"http": true, "https": true, "mailto": true}
+)
+
+// renderMarkdown turns a small, commonly used subset of Markdown into HTML:
+// headings, paragraphs, lists, quotes, rules, fenced code, code spans,
+// emphasis and links. Everything else is shown as text, and raw HTML is
+// always escaped.
+func renderMarkdown(source string) template.HTML {
+	lines := strings.Split(strings.Replace(source, "\r\n", "\n", -1), "\n")
+	var out strings.Builder
+	var paragraph []string
+	list := ""
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + renderInline(strings.Join(paragraph, "\n")) + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			out.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	openList := func(tag string) {
+		if list != tag {
+			closeList()
+			out.WriteString("<" + tag + ">\n")
+			list = tag
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			flushParagraph()
+			closeList()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			out.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			flushParagraph()
+			closeList()
+			continue
+		}
+
+		if markdownRule.MatchString(line) {
+			flushParagraph()
+			closeList()
+			out.WriteString("<hr>\n")
+			continue
+		}
+
+		if m := markdownHeading.FindStringSubmatch(line); m != nil {
+			flushParagraph()
+			closeList()
+			level := strconv.Itoa(len(m[1]))
+			out.WriteString("<h" + level + ">" + renderInline(m[2]) + "</h" + level + ">\n")
+			continue
+		}
+
+		if m := markdownBullet.FindStringSubmatch(line); m != nil {
+			flushParagraph()
+			openList("ul")
+			out.WriteString("<li>" + renderInline(m[1]) + "</li>\n")
+			continue
+		}
+
+		if m := markdownNumbered.FindStringSubmatch(line); m != nil {
+			flushParagraph()
+			openList("ol")
+			out.WriteString("<li>" + renderInline(m[1]) + "</li>\n")
+			continue
+		}
+
+		if markdownQuote.MatchString(line) {
+			flushParagraph()
+			closeList()
+			var quote []string
+			for ; i < len(lines) && markdownQuote.MatchString(lines[i]); i++ {
+				quote = append(quote, markdownQuote.FindStringSubmatch(lines[i])[1])
+			}
+			i--
+			out.WriteString("<blockquote><p>" + renderInline(strings.Join(quote, "\n")) + "</p></blockquote>\n")
+			continue
+		}
+
+		closeList()
+		paragraph = append(paragraph, strings.TrimSpace(line))
+	}
+	flushParagraph()
+	closeList()
+
+	return template.HTML(out.String())
+}
+
+// renderInline escapes a line of text and renders its code spans, links
+// and emphasis
+func renderInline(text string) string {
+	text = strings.Replace(text, "\x00", "", -1)
+
+	// Code spans and links are set aside while emphasis is rendered so that
+	// their contents are left alone
+	var kept []string
+	keep := func(s string) string {
+		kept = append(kept, s)
+		return "\x00" + strconv.Itoa(len(kept)-1) + "\x00"
+	}
+
+	var out strings.Builder
+	for i, part := range strings.Split(text, "`") {
+		// Odd parts are between backticks, unless the last backtick is not
+		// closed
+		if i%2 == 1 && strings.Count(text, "`") > i {
+			out.WriteString(keep("<code>" + html.EscapeString(part) + "</code>"))
+			continue
+		}
+		if i%2 == 1 {
+			out.WriteString("`")
+		}
+		out.WriteString(html.EscapeString(part))
+	}
+	escaped := out.String()
+
+	escaped = markdownLink.ReplaceAllStringFunc(escaped, func(link string) string {
+		m := markdownLink.FindStringSubmatch(link)
+		u, err := url.Parse(html.UnescapeString(m[2]))
+		if err != nil || !markdownLinkScheme[strings.ToLower(u.Scheme)] {
+			return m[1]
+		}
+		return keep(`<a href="`+m[2]+`" rel="nofollow noopener">`) + m[1] + keep("</a>")
+	})
+	escaped = markdownStrong.ReplaceAllString(escaped, "<strong>$1$2</strong>")
+	escaped = markdownEmphasis.ReplaceAllString(escaped, "<em>$1$2</em>")
+
+	for i, s := range kept {
+		escaped = strings.Replace(escaped, "\x00"+strconv.Itoa(i)+"\x00", s, 1)
+	}
+	return escaped
+}
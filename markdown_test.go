@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	require := require.New(t)
+
+	tests := map[string]string{
+		"# Title":                     "<h1>Title</h1>",
+		"Hello *there* **you**":       "<p>Hello <em>there</em> <strong>you</strong></p>",
+		"- one\n- two":                "<ul>\n<li>one</li>\n<li>two</li>\n</ul>",
+		"1. one\n2. two":              "<ol>\n<li>one</li>\n<li>two</li>\n</ol>",
+		"> quoted":                    "<blockquote><p>quoted</p></blockquote>",
+		"---":                         "<hr>",
+		"Use `a<b`":                   "<p>Use <code>a&lt;b</code></p>",
+		"```\n<script>\n```":          "<pre><code>&lt;script&gt;</code></pre>",
+		"<b>bold</b>":                 "<p>&lt;b&gt;bold&lt;/b&gt;</p>",
+		"[site](https://example.com)": `<p><a href="https://example.com" rel="nofollow noopener">site</a></p>`,
+		"[bad](javascript:alert)":     "<p>bad</p>",
+	}
+	for source, expected := range tests {
+		require.Equal(expected, strings.TrimSpace(string(renderMarkdown(source))), source)
+	}
+}
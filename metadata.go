@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits for the metadata of a link
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 1000
+	maxNotesLength       = 10000
+	maxTags              = 20
+	maxTagLength         = 50
+)
+
+// bindMetadata validates the title, description, notes and tags of a link.
+// Tags are lowercased and duplicates are dropped.
+func (link *Link) bindMetadata() error {
+	link.Title = strings.TrimSpace(link.Title)
+	link.Description = strings.TrimSpace(link.Description)
+
+	for _, field := range []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"Title", link.Title, maxTitleLength},
+		{"Description", link.Description, maxDescriptionLength},
+		{"Notes", link.Notes, maxNotesLength},
+	} {
+		if utf8.RuneCountInString(field.value) > field.max {
+			return errors.New(field.name + " can be at most " + strconv.Itoa(field.max) + " characters")
+		}
+	}
+
+	tags, err := normalizeTags(link.Tags)
+	if err != nil {
+		return err
+	}
+	link.Tags = tags
+	return nil
+}
+
+// normalizeTags lowercases and trims tags and removes empty and duplicate
+// ones
+func normalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, errors.New("Tags can be at most " + strconv.Itoa(maxTagLength) + " characters")
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTags {
+		return nil, errors.New("A link can have at most " + strconv.Itoa(maxTags) + " tags")
+	}
+	return normalized, nil
+}
+
+// hideDestination clears where the link leads, for listings of links that
+// can only be followed with a password or once they are active
+func (link *Link) hideDestination() {
+	link.URL = ""
+	link.OriginalURL = ""
+	link.FallbackURL = ""
+	link.Variants = nil
+	link.Rules = nil
+	link.Items = nil
+	link.Content = ""
+}
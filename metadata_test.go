@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	require := require.New(t)
+
+	tags, err := normalizeTags([]string{" Go ", "go", "", "Elastic"})
+	require.NoError(err)
+	require.Equal([]string{"go", "elastic"}, tags)
+
+	_, err = normalizeTags([]string{strings.Repeat("x", maxTagLength+1)})
+	require.Error(err)
+
+	many := make([]string, maxTags+1)
+	for i := range many {
+		many[i] = strings.Repeat("x", i+1)
+	}
+	_, err = normalizeTags(many)
+	require.Error(err)
+}
+
+func TestBindMetadata(t *testing.T) {
+	require := require.New(t)
+
+	link := &Link{Title: "  Docs  ", Tags: []string{"A", "a"}}
+	require.NoError(link.bindMetadata())
+	require.Equal("Docs", link.Title)
+	require.Equal([]string{"a"}, link.Tags)
+
+	link = &Link{Title: strings.Repeat("x", maxTitleLength+1)}
+	require.Error(link.bindMetadata())
+}
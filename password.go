@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	passwordIterations = 100000
+	passwordSaltLength = 16
+	passwordKeyLength  = 32
+)
+
+// hashPassword returns a salted PBKDF2-SHA256 hash of the password in the
+// form `pbkdf2-sha256$iterations$salt$hash`
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := pbkdf2([]byte(password), salt, passwordIterations, passwordKeyLength)
+	return strings.Join([]string{
+		"pbkdf2-sha256",
+		strconv.Itoa(passwordIterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$"), nil
+}
+
+// checkPassword tells you if the password matches a hash made by
+// hashPassword
+func checkPassword(hash, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false, errors.New("Unknown password hash format")
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false, err
+	}
+	actual := pbkdf2([]byte(password), salt, iterations, len(key))
+	return subtle.ConstantTimeCompare(key, actual) == 1, nil
+}
+
+// pbkdf2 derives a key from a password as described in RFC 8018 using
+// HMAC-SHA256
+func pbkdf2(password, salt []byte, iterations, keyLength int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLength := prf.Size()
+	blocks := (keyLength + hashLength - 1) / hashLength
+
+	key := make([]byte, 0, blocks*hashLength)
+	u := make([]byte, hashLength)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		key = prf.Sum(key)
+		t := key[len(key)-hashLength:]
+		copy(u, t)
+
+		for i := 2; i <= iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range u {
+				t[j] ^= u[j]
+			}
+		}
+	}
+	return key[:keyLength]
+}
+
+// passwordThrottle limits how often a wrong password can be tried for a
+// link. After too many failures the link is locked for a while.
+type passwordThrottle struct {
+	mu       sync.Mutex
+	attempts map[string]*passwordAttempts
+}
+
+type passwordAttempts struct {
+	failures    int
+	lockedUntil time.Time
+}
+
+var throttle = &passwordThrottle{attempts: map[string]*passwordAttempts{}}
+
+// Locked returns how long the link is locked for, or 0 if passwords may be
+// tried
+func (t *passwordThrottle) Locked(id string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	attempts, ok := t.attempts[id]
+	if !ok {
+		return 0
+	}
+	wait := time.Until(attempts.lockedUntil)
+	if wait <= 0 {
+		if !attempts.lockedUntil.IsZero() {
+			delete(t.attempts, id)
+		}
+		return 0
+	}
+	return wait
+}
+
+// Fail records a wrong password for the link
+func (t *passwordThrottle) Fail(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	attempts, ok := t.attempts[id]
+	if !ok {
+		attempts = &passwordAttempts{}
+		t.attempts[id] = attempts
+	}
+	attempts.failures++
+	if attempts.failures >= config.PasswordAttempts {
+		attempts.failures = 0
+		attempts.lockedUntil = time.Now().Add(config.PasswordLockout)
+	}
+}
+
+// Reset forgets the failures of a link after the right password was given
+func (t *passwordThrottle) Reset(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.attempts, id)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPassword(t *testing.T) {
+	require := require.New(t)
+
+	hash, err := hashPassword("hunter2")
+	require.NoError(err)
+	require.NotContains(hash, "hunter2")
+
+	other, err := hashPassword("hunter2")
+	require.NoError(err)
+	require.NotEqual(hash, other)
+
+	ok, err := checkPassword(hash, "hunter2")
+	require.NoError(err)
+	require.True(ok)
+
+	ok, err = checkPassword(hash, "hunter3")
+	require.NoError(err)
+	require.False(ok)
+
+	_, err = checkPassword("plain", "hunter2")
+	require.Error(err)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/syntaqx/go-chi-render"
+)
+
+// pasteFormats are the formats pastes can be written in
+var pasteFormats = map[string]bool{
+	"text":     true,
+	"markdown": true,
+}
+
+// IsPaste tells you if the link shows text instead of redirecting
+func (link *Link) IsPaste() bool {
+	return link.Content != "" || link.Format != ""
+}
+
+// bindPaste validates the content of a paste. Pastes have no destination so
+// the settings for redirects can not be used with them.
+func (link *Link) bindPaste() error {
+	if link.Content == "" {
+		return errors.New("Pastes need content")
+	}
+	if len(link.Content) > config.MaxPasteSize {
+		return errors.New("Pastes can be at most " + strconv.Itoa(config.MaxPasteSize) + " bytes")
+	}
+	if link.Format == "" {
+		link.Format = "text"
+	}
+	if !pasteFormats[link.Format] {
+		return errors.New("Paste format must be text or markdown")
+	}
+	if link.URL != "" || len(link.Variants) > 0 || len(link.Rules) > 0 {
+		return errors.New("Pastes can not have a URL")
+	}
+	if link.ForwardPath || link.ForwardQuery || len(link.Campaign) > 0 || link.RedirectStatus != 0 {
+		return errors.New("Pastes can not have redirect settings")
+	}
+	return nil
+}
+
+// HTML returns the content of a paste as HTML
+func (link *Link) HTML() template.HTML {
+	if link.Format == "markdown" {
+		return renderMarkdown(link.Content)
+	}
+	return template.HTML("<pre>" + template.HTMLEscapeString(link.Content) + "</pre>")
+}
+
+// pasteContentTypes maps raw request bodies to the format of their paste
+var pasteContentTypes = map[string]string{
+	"text/plain":    "text",
+	"text/markdown": "markdown",
+}
+
+// bindLink binds a link from the request. Raw text and markdown bodies
+// create pastes, anything else is decoded as usual.
+func bindLink(r *http.Request, link *Link) error {
+	contentType := strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0])
+	if format, ok := pasteContentTypes[contentType]; ok {
+		return readPaste(r, link, format)
+	}
+	return render.Bind(r, link)
+}
+
+// readPaste binds a paste sent as a raw text or markdown request body.
+// Settings that would go into a form are read from the query instead.
+func readPaste(r *http.Request, link *Link, format string) error {
+	content, err := ioutil.ReadAll(io.LimitReader(r.Body, int64(config.MaxPasteSize)+1))
+	if err != nil {
+		return err
+	}
+	link.Content = string(content)
+	link.Format = format
+	link.Title = r.URL.Query().Get("title")
+	link.ExpiresIn = r.URL.Query().Get("expires_in")
+	link.Once = queryBool(r, "once", false)
+	return link.Bind(r)
+}
+
+// showPaste counts a view of the paste and renders its content
+func showPaste(w http.ResponseWriter, r *http.Request, link *Link) {
+	countHit(w, link, -1)
+	render.Render(w, WithTemplate(r, "link.paste"), link)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// maxPatchSize is the largest patch body that is read
+const maxPatchSize = 1 << 20
+
+// Patch returns a copy of the link with a JSON merge patch (RFC 7396)
+// applied. The patched link is validated like a new one, but keeps its ID,
+// owner, hits and creation time. Setting `password` to null removes the
+// password.
+func (link *Link) Patch(r *http.Request, patch []byte) (*Link, error) {
+	var changes map[string]interface{}
+	if err := json.Unmarshal(patch, &changes); err != nil || changes == nil {
+		return nil, errors.New("Patch must be a JSON object")
+	}
+	// These are managed by the server
+	for _, name := range []string{"id", "owner", "@timestamp", "updated_at", "deleted_at", "original_url"} {
+		delete(changes, name)
+	}
+
+	current, err := json.Marshal(link)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(current, &document); err != nil {
+		return nil, err
+	}
+	// A new relative expiry replaces the current expiry time, and the expiry
+	// time of idle links is worked out again from their idle time
+	_, relative := changes["expires_in"]
+	if relative || document["expires_after_idle"] != nil {
+		if _, ok := changes["expires"]; !ok {
+			delete(document, "expires")
+		}
+	}
+
+	patched, err := json.Marshal(mergePatch(document, changes))
+	if err != nil {
+		return nil, err
+	}
+	updated := &Link{}
+	if err := json.Unmarshal(patched, updated); err != nil {
+		return nil, err
+	}
+	if err := updated.Bind(r); err != nil {
+		return nil, err
+	}
+
+	updated.ID = link.ID
+	updated.Owner = link.Owner
+	updated.Timestamp = link.Timestamp
+	updated.HitCount = link.HitCount
+	updated.LastHit = link.LastHit
+	if updated.URL == link.URL {
+		updated.OriginalURL = link.OriginalURL
+	}
+	if password, ok := changes["password"]; !ok || password != nil {
+		updated.PasswordHash = link.PasswordHash
+	}
+	for i := range updated.Variants {
+		for _, old := range link.Variants {
+			if old.URL == updated.Variants[i].URL {
+				updated.Variants[i].Hits = old.Hits
+			}
+		}
+	}
+	for i := range updated.Items {
+		for _, old := range link.Items {
+			if old.ID == updated.Items[i].ID {
+				updated.Items[i].Hits = old.Hits
+			}
+		}
+	}
+	updated.UpdatedAt = time.Now()
+
+	return updated, nil
+}
+
+// mergePatch applies a JSON merge patch to a document. Objects are merged
+// recursively, null removes a member and anything else replaces it.
+func mergePatch(document interface{}, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	target, ok := document.(map[string]interface{})
+	if !ok {
+		target = map[string]interface{}{}
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(target, name)
+			continue
+		}
+		target[name] = mergePatch(target[name], value)
+	}
+	return target
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	require := require.New(t)
+
+	document := map[string]interface{}{
+		"url":      "https://example.com/",
+		"title":    "Example",
+		"campaign": map[string]interface{}{"utm_source": "short", "utm_medium": "link"},
+	}
+	patched := mergePatch(document, map[string]interface{}{
+		"title":    nil,
+		"campaign": map[string]interface{}{"utm_medium": nil, "utm_campaign": "sale"},
+		"tags":     []interface{}{"a"},
+	})
+	require.Equal(map[string]interface{}{
+		"url":      "https://example.com/",
+		"campaign": map[string]interface{}{"utm_source": "short", "utm_campaign": "sale"},
+		"tags":     []interface{}{"a"},
+	}, patched)
+}
+
+func TestLinkPatchFields(t *testing.T) {
+	require := require.New(t)
+
+	created := time.Date(2018, 11, 20, 12, 0, 0, 0, time.UTC)
+	link := &Link{
+		ID:           "abc",
+		URL:          "https://example.com/",
+		OriginalURL:  "https://EXAMPLE.com",
+		Title:        "Example",
+		HitCount:     42,
+		HitLimit:     100,
+		Expires:      created.Add(24 * time.Hour),
+		PasswordHash: "hash",
+		Owner:        "sam",
+		Timestamp:    created,
+		Variants:     []Variant{{URL: "https://example.com/", Weight: 1, Hits: 40}},
+	}
+	r := httptest.NewRequest("PATCH", "/abc", nil)
+
+	updated, err := link.Patch(r, []byte(`{"title": "New", "owner": "kim", "@timestamp": "2000-01-01T00:00:00Z", "expires_in": "1d"}`))
+	require.NoError(err)
+	require.Equal("abc", updated.ID)
+	require.Equal("New", updated.Title)
+	require.Equal("https://example.com/", updated.URL)
+	require.Equal("https://EXAMPLE.com", updated.OriginalURL)
+	require.Equal(int64(42), updated.HitCount)
+	require.Equal(int64(100), updated.HitLimit)
+	require.Equal(int64(40), updated.Variants[0].Hits)
+	require.Equal("hash", updated.PasswordHash)
+	require.Equal("sam", updated.Owner)
+	require.Equal(created, updated.Timestamp)
+	require.True(updated.Expires.IsZero())
+	require.Equal("1d", updated.ExpiresIn)
+	require.False(updated.UpdatedAt.IsZero())
+
+	updated, err = link.Patch(r, []byte(`{"password": null, "limit": null}`))
+	require.NoError(err)
+	require.Equal("", updated.PasswordHash)
+	require.Equal(int64(0), updated.HitLimit)
+
+	updated, err = link.Patch(r, []byte(`{"variants": [{"url": "https://example.org/a", "weight": 1}, {"url": "https://example.org/b", "weight": 1}]}`))
+	require.NoError(err)
+	require.Equal("https://example.org/a", updated.URL)
+	require.Len(updated.Variants, 2)
+
+	idle := &Link{ID: "idle", URL: "https://example.com/", ExpiresAfterIdle: "7d", Expires: created.Add(7 * 24 * time.Hour)}
+	updated, err = idle.Patch(r, []byte(`{"title": "Idle"}`))
+	require.NoError(err)
+	require.Equal("7d", updated.ExpiresAfterIdle)
+	updated, err = idle.Patch(r, []byte(`{"expires_after_idle": null}`))
+	require.NoError(err)
+	require.True(updated.Expires.IsZero())
+	_, err = idle.Patch(r, []byte(`{"expires_in": "1d"}`))
+	require.Error(err)
+
+	_, err = link.Patch(r, []byte(`{"url": "ftp://example.com/", "variants": null}`))
+	require.Error(err)
+
+	_, err = link.Patch(r, []byte(`[]`))
+	require.Error(err)
+}
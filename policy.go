@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// privateNetworks are the address ranges that are not reachable from the
+// public internet
+var privateNetworks []*net.IPNet
+
+func init() {
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+	} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		privateNetworks = append(privateNetworks, network)
+	}
+}
+
+// Policy decides which destinations links are allowed to point to
+type Policy struct {
+	// Schemes that destinations may use
+	Schemes []string
+	// AllowedDomains, when not empty, are the only domains that destinations
+	// may point to. Entries may contain wildcards such as `*.example.com`.
+	AllowedDomains []string
+	// BlockedDomains are domains that destinations may never point to.
+	// Entries may contain wildcards such as `*.example.com`.
+	BlockedDomains []string
+	// BlockPrivate rejects destinations on localhost and private networks
+	BlockPrivate bool
+	// MaxURLLength is the longest URL that is accepted, 0 means no limit
+	MaxURLLength int
+}
+
+// Check returns an error if the URL is not allowed by the Policy
+func (p *Policy) Check(rawurl string) error {
+	if p.MaxURLLength > 0 && len(rawurl) > p.MaxURLLength {
+		return errors.New("URL is longer than " + strconv.Itoa(p.MaxURLLength) + " characters")
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+
+	if !containsFold(p.Schemes, u.Scheme) {
+		return errors.New("URL scheme " + u.Scheme + " is not allowed")
+	}
+
+	host, err := asciiHostname(strings.TrimSuffix(u.Hostname(), "."))
+	if err != nil {
+		return err
+	}
+
+	if p.BlockPrivate && isPrivateHost(host) {
+		return errors.New("URL points to a private address")
+	}
+
+	if len(p.AllowedDomains) > 0 && !matchDomain(p.AllowedDomains, host) {
+		return errors.New("URL domain " + host + " is not allowed")
+	}
+
+	if matchDomain(p.BlockedDomains, host) {
+		return errors.New("URL domain " + host + " is blocked")
+	}
+
+	return nil
+}
+
+// matchDomain tells you if the host matches any of the domain patterns
+func matchDomain(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		pattern, err := asciiHostname(pattern)
+		if err != nil {
+			continue
+		}
+		if matched, _ := path.Match(pattern, host); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func isPrivateHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	ip := parseIPv4(host)
+	if ip == nil {
+		ip = net.ParseIP(host)
+	}
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIPv4 parses an IPv4 address the way browsers do (see the WHATWG URL
+// standard), so shorthands such as `127.1`, `0x7f000001` and `0177.0.0.1`
+// are understood. It returns nil if host is not an IPv4 address.
+func parseIPv4(host string) net.IP {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+
+	var n uint64
+	for i, part := range parts {
+		base := 10
+		switch {
+		case strings.HasPrefix(part, "0x") || strings.HasPrefix(part, "0X"):
+			part, base = part[2:], 16
+			if part == "" {
+				part = "0"
+			}
+		case len(part) > 1 && part[0] == '0':
+			part, base = part[1:], 8
+		}
+		value, err := strconv.ParseUint(part, base, 32)
+		if err != nil {
+			return nil
+		}
+
+		// The last part fills all of the bytes that are left
+		if i == len(parts)-1 {
+			if value >= 1<<uint(8*(4-i)) {
+				return nil
+			}
+			n = n<<uint(8*(4-i)) | value
+		} else {
+			if value > 255 {
+				return nil
+			}
+			n = n<<8 | value
+		}
+	}
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func containsFold(list []string, s string) bool {
+	for _, element := range list {
+		if strings.EqualFold(element, s) {
+			return true
+		}
+	}
+	return false
+}
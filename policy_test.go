@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	require := require.New(t)
+
+	policy := &Policy{
+		Schemes:        []string{"http", "https"},
+		BlockedDomains: []string{"*.evil.example", "evil.example"},
+		BlockPrivate:   true,
+		MaxURLLength:   64,
+	}
+
+	allowed := []string{
+		"https://example.com/",
+		"http://sub.example.com/path",
+		"https://notevil.example/",
+		"https://8.8.8.8/",
+		"https://8.8.2056/",
+		"https://0x7f.example.com/",
+	}
+	for _, u := range allowed {
+		require.NoError(policy.Check(u), u)
+	}
+
+	blocked := []string{
+		"javascript://x/%0aalert(1)",
+		"file:///etc/passwd",
+		"data:text/html,hi",
+		"ftp://example.com/",
+		"https://evil.example/",
+		"https://www.evil.example/",
+		"http://localhost:3000/",
+		"http://app.localhost/",
+		"http://127.0.0.1/",
+		"http://2130706433/",
+		"http://127.1/",
+		"http://0x7f000001/",
+		"http://0177.0.0.1/",
+		"http://0xa.1/",
+		"http://10.1.2.3/",
+		"http://192.168.0.1/",
+		"http://[::1]/",
+		"https://example.com/" + strings.Repeat("a", 64),
+	}
+	for _, u := range blocked {
+		require.Error(policy.Check(u), u)
+	}
+
+	policy.AllowedDomains = []string{"*.example.com"}
+	require.NoError(policy.Check("https://docs.example.com/"))
+	require.Error(policy.Check("https://example.org/"))
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Revision is an immutable record of a change to a link
+type Revision struct {
+	ID     string `json:"id" db:"-"`
+	LinkID string `json:"link_id" db:"link_id;type:keyword"`
+	// Author is the owner of the API key the change was made with, empty for
+	// anonymous changes
+	Author string `json:"author,omitempty" db:"author;type:keyword"`
+	// Action is one of "create", "replace", "update", "delete", "restore" or
+	// "rollback"
+	Action string `json:"action" db:"action;type:keyword"`
+	// Before and After are the link as the API shows it before and after the
+	// change. Before is empty for new links.
+	Before map[string]interface{} `json:"before,omitempty" db:"before;type:object;enabled:false"`
+	After  map[string]interface{} `json:"after,omitempty" db:"after;type:object;enabled:false"`
+	// Changed are the fields that are different after the change
+	Changed   []string  `json:"changed,omitempty" db:"changed;type:keyword"`
+	Timestamp time.Time `json:"@timestamp" db:"@timestamp;type:date"`
+}
+
+// Render is a `go-chi` middleware
+func (revision *Revision) Render(w http.ResponseWriter, r *http.Request) error {
+	// The snapshots leave out the same fields as the link itself
+	var err error
+	if revision.Before != nil {
+		if revision.Before, err = renderSnapshot(w, r, revision.Before); err != nil {
+			return err
+		}
+	}
+	if revision.After != nil {
+		if revision.After, err = renderSnapshot(w, r, revision.After); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Index returns the Elastic index name
+func (revision *Revision) Index() string {
+	return "revisions"
+}
+
+// GenerateID sets a random ID, revisions are normally created with IDs
+// chosen by Elastic
+func (revision *Revision) GenerateID() error {
+	id := make([]byte, 10)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	revision.ID = hex.EncodeToString(id)
+	return nil
+}
+
+// Prepare makes sure that the Revision has a Timestamp
+func (revision *Revision) Prepare() error {
+	if revision.Timestamp.IsZero() {
+		revision.Timestamp = time.Now()
+	}
+	return nil
+}
+
+// recordRevision saves a revision for a change of a link by author. before
+// is nil for new links.
+func recordRevision(author string, action string, before *Link, after *Link) error {
+	revision := &Revision{
+		LinkID: strings.ToLower(after.ID),
+		Author: author,
+		Action: action,
+	}
+
+	var err error
+	if before != nil {
+		if revision.Before, err = linkSnapshot(before); err != nil {
+			return err
+		}
+	}
+	if revision.After, err = linkSnapshot(after); err != nil {
+		return err
+	}
+	revision.Changed = changedFields(revision.Before, revision.After)
+
+	return db.Create(revision)
+}
+
+// linkSnapshot returns the fields of a link as the API shows them
+func linkSnapshot(link *Link) (map[string]interface{}, error) {
+	jsonbytes, err := json.Marshal(link)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot map[string]interface{}
+	err = json.Unmarshal(jsonbytes, &snapshot)
+	return snapshot, err
+}
+
+// renderSnapshot returns a snapshot as Link.Render would show the link
+func renderSnapshot(w http.ResponseWriter, r *http.Request, snapshot map[string]interface{}) (map[string]interface{}, error) {
+	jsonbytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	link := &Link{}
+	if err := json.Unmarshal(jsonbytes, link); err != nil {
+		return nil, err
+	}
+	if err := link.Render(w, r); err != nil {
+		return nil, err
+	}
+	return linkSnapshot(link)
+}
+
+// changedFields returns the names of the fields that differ between two
+// snapshots, leaving out when the link was updated
+func changedFields(before, after map[string]interface{}) []string {
+	changed := []string{}
+	for name, value := range after {
+		if old, ok := before[name]; !ok || !reflect.DeepEqual(old, value) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+
+	fields := changed[:0]
+	for _, name := range changed {
+		if name != "updated_at" {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// findRevisions returns the revisions of a link, newest first
+func findRevisions(linkID string) ([]*Revision, error) {
+	records, err := db.Search(&Revision{}, map[string]interface{}{
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{"link_id": strings.ToLower(linkID)},
+		},
+		"sort": []interface{}{
+			map[string]interface{}{"@timestamp": "desc"},
+		},
+		"size": 100,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]*Revision, len(records))
+	for i, record := range records {
+		revisions[i] = &Revision{}
+		if err := record.Decode(revisions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return revisions, nil
+}
+
+// findRevision returns a revision of a link by its ID
+func findRevision(linkID string, id string) (*Revision, error) {
+	records, err := db.Search(&Revision{}, map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"_id": id}},
+					map[string]interface{}{"term": map[string]interface{}{"link_id": strings.ToLower(linkID)}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("Revision not found in database")
+	}
+
+	revision := &Revision{}
+	return revision, records[0].Decode(revision)
+}
+
+// rollbackPatch returns a JSON merge patch that turns the link back into how
+// it was after the revision
+func rollbackPatch(link *Link, revision *Revision) ([]byte, error) {
+	current, err := linkSnapshot(link)
+	if err != nil {
+		return nil, err
+	}
+	patch := map[string]interface{}{}
+	for name := range current {
+		patch[name] = nil
+	}
+	for name, value := range revision.After {
+		patch[name] = value
+	}
+	// The expiry time of idle links is worked out again when they are saved
+	if _, ok := revision.After["expires_after_idle"]; ok {
+		patch["expires"] = nil
+	}
+	return json.Marshal(patch)
+}
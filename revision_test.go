@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedFields(t *testing.T) {
+	require := require.New(t)
+
+	before := map[string]interface{}{"url": "https://example.com/", "title": "Example", "updated_at": "a"}
+	after := map[string]interface{}{"url": "https://example.org/", "tags": []interface{}{"a"}, "updated_at": "b"}
+	require.Equal([]string{"tags", "title", "url"}, changedFields(before, after))
+	require.Equal([]string{}, changedFields(after, after))
+}
+
+func TestRollbackPatch(t *testing.T) {
+	require := require.New(t)
+
+	link := &Link{ID: "abc", URL: "https://example.org/", Title: "New"}
+	revision := &Revision{After: map[string]interface{}{"id": "abc", "url": "https://example.com/"}}
+
+	patch, err := rollbackPatch(link, revision)
+	require.NoError(err)
+	var changes map[string]interface{}
+	require.NoError(json.Unmarshal(patch, &changes))
+	require.Equal("https://example.com/", changes["url"])
+	require.Contains(changes, "title")
+	require.Nil(changes["title"])
+
+	revision = &Revision{After: map[string]interface{}{"id": "abc", "url": "https://example.com/", "expires_after_idle": "7d", "expires": "2019-01-08T00:00:00Z"}}
+	patch, err = rollbackPatch(link, revision)
+	require.NoError(err)
+	changes = nil
+	require.NoError(json.Unmarshal(patch, &changes))
+	require.Contains(changes, "expires")
+	require.Nil(changes["expires"])
+
+	r := httptest.NewRequest("POST", "/api/links/abc/history/1/rollback", nil)
+	updated, err := link.Patch(r, patch)
+	require.NoError(err)
+	require.Equal("7d", updated.ExpiresAfterIdle)
+	require.NoError(updated.Prepare())
+	require.False(updated.Expires.IsZero())
+}
+
+func TestRevisionRender(t *testing.T) {
+	require := require.New(t)
+
+	config.APIKeys = map[string]string{"sam-key": "sam"}
+	defer func() { config.APIKeys = nil }()
+
+	snapshot := func() map[string]interface{} {
+		return map[string]interface{}{"id": "abc", "url": "https://example.com/", "notes": "Private", "owner": "sam", "limit": 5}
+	}
+
+	revision := &Revision{Before: snapshot(), After: snapshot()}
+	r := httptest.NewRequest("GET", "/api/links/abc/history", nil)
+	require.NoError(revision.Render(httptest.NewRecorder(), r))
+	for _, rendered := range []map[string]interface{}{revision.Before, revision.After} {
+		require.Equal("https://example.com/", rendered["url"])
+		require.NotContains(rendered, "notes")
+		require.NotContains(rendered, "owner")
+		require.NotContains(rendered, "limit")
+	}
+
+	revision = &Revision{After: snapshot()}
+	r.Header.Set("Authorization", "Bearer sam-key")
+	require.NoError(revision.Render(httptest.NewRecorder(), r))
+	require.Nil(revision.Before)
+	require.Equal("Private", revision.After["notes"])
+	require.NotContains(revision.After, "limit")
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRules is the most routing rules a link can have
+const maxRules = 20
+
+// platforms are the values Rule.Platforms can contain
+var platforms = map[string]bool{
+	"ios":     true,
+	"android": true,
+	"windows": true,
+	"macos":   true,
+	"linux":   true,
+}
+
+// Rule sends visitors that match all of its conditions to URL. Conditions
+// that are left empty match every visitor.
+type Rule struct {
+	URL string `json:"url" form:"url"`
+	// Platforms are matched against the User-Agent, see detectPlatform
+	Platforms []string `json:"platforms,omitempty" form:"platforms,omitempty"`
+	// Languages are matched against the preferred language of the visitor
+	// from Accept-Language, "de" also matches "de-AT"
+	Languages []string `json:"languages,omitempty" form:"languages,omitempty"`
+	// Countries are ISO 3166-1 codes matched against the country of the
+	// visitor, which is looked up in the GeoIP database
+	Countries []string `json:"countries,omitempty" form:"countries,omitempty"`
+	// From and To limit the rule to a time of day in "15:04" format. When
+	// From is later than To the window wraps around midnight.
+	From string `json:"from,omitempty" form:"from,omitempty"`
+	To   string `json:"to,omitempty" form:"to,omitempty"`
+	// Timezone From and To are in, UTC by default
+	Timezone string `json:"timezone,omitempty" form:"timezone,omitempty"`
+}
+
+// bindRules validates the rules of a link and canonicalises their URLs
+func (link *Link) bindRules() error {
+	if len(link.Rules) == 0 {
+		return nil
+	}
+	if len(link.Rules) > maxRules {
+		return errors.New("A link can have at most " + strconv.Itoa(maxRules) + " rules")
+	}
+	if isTemplate(link.URL) {
+		return errors.New("Template links can not have rules")
+	}
+
+	for i := range link.Rules {
+		rule := &link.Rules[i]
+		if isTemplate(rule.URL) {
+			return errors.New("Rule URLs can not have placeholders")
+		}
+		canonical, err := checkDestination(rule.URL)
+		if err != nil {
+			return err
+		}
+		rule.URL = canonical
+
+		for j, platform := range rule.Platforms {
+			rule.Platforms[j] = strings.ToLower(platform)
+			if !platforms[rule.Platforms[j]] {
+				return errors.New("Unknown platform " + platform)
+			}
+		}
+		for j, country := range rule.Countries {
+			rule.Countries[j] = strings.ToUpper(country)
+			if len(country) != 2 {
+				return errors.New("Unknown country " + country)
+			}
+		}
+		if (rule.From == "") != (rule.To == "") {
+			return errors.New("Rules need both from and to")
+		}
+		for _, clock := range []string{rule.From, rule.To} {
+			if _, err := parseClock(clock); clock != "" && err != nil {
+				return err
+			}
+		}
+		if _, err := time.LoadLocation(rule.Timezone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchRule returns the index of the first rule that matches the request
+// or -1 if none do
+func (link *Link) matchRule(r *http.Request, now time.Time) int {
+	if len(link.Rules) == 0 {
+		return -1
+	}
+
+	platform := detectPlatform(r.UserAgent())
+	language := preferredLanguage(r.Header.Get("Accept-Language"))
+	country := ""
+	countryKnown := false
+
+	for i, rule := range link.Rules {
+		if len(rule.Platforms) > 0 && !containsFold(rule.Platforms, platform) {
+			continue
+		}
+		if len(rule.Languages) > 0 && !matchLanguage(rule.Languages, language) {
+			continue
+		}
+		if len(rule.Countries) > 0 {
+			if !countryKnown {
+				country = geoip.Country(clientIP(r, config.TrustedProxies))
+				countryKnown = true
+			}
+			if !containsFold(rule.Countries, country) {
+				continue
+			}
+		}
+		if rule.From != "" && !rule.inWindow(now) {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// inWindow tells you if the time of day of now is between From and To
+func (rule *Rule) inWindow(now time.Time) bool {
+	location, err := time.LoadLocation(rule.Timezone)
+	if err != nil {
+		return false
+	}
+	from, err := parseClock(rule.From)
+	if err != nil {
+		return false
+	}
+	to, err := parseClock(rule.To)
+	if err != nil {
+		return false
+	}
+
+	local := now.In(location)
+	clock := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+	if from <= to {
+		return clock >= from && clock < to
+	}
+	return clock >= from || clock < to
+}
+
+// parseClock parses a time of day in "15:04" format into the time since
+// midnight
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.New("Invalid time of day " + s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// detectPlatform guesses the operating system of a visitor from their
+// User-Agent. It returns an empty string if it is not recognised.
+func detectPlatform(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "iPod"):
+		return "ios"
+	case strings.Contains(userAgent, "Android"):
+		return "android"
+	case strings.Contains(userAgent, "Windows"):
+		return "windows"
+	case strings.Contains(userAgent, "Macintosh"), strings.Contains(userAgent, "Mac OS X"):
+		return "macos"
+	case strings.Contains(userAgent, "Linux"):
+		return "linux"
+	}
+	return ""
+}
+
+// preferredLanguage returns the language with the highest quality from an
+// Accept-Language header, lowercased
+func preferredLanguage(header string) string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+
+	var languages []language
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			languages = append(languages, language{tag, quality})
+		}
+	}
+	if len(languages) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+	return languages[0].tag
+}
+
+// matchLanguage tells you if the language is one of the given languages or
+// a regional variant of one
+func matchLanguage(languages []string, language string) bool {
+	if language == "" {
+		return false
+	}
+	for _, l := range languages {
+		l = strings.ToLower(l)
+		if language == l || strings.HasPrefix(language, l+"-") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectPlatform(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("ios", detectPlatform("Mozilla/5.0 (iPhone; CPU iPhone OS 12_1 like Mac OS X) AppleWebKit/605.1.15"))
+	require.Equal("android", detectPlatform("Mozilla/5.0 (Linux; Android 9; Pixel 3) AppleWebKit/537.36"))
+	require.Equal("windows", detectPlatform("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36"))
+	require.Equal("macos", detectPlatform("Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_1) AppleWebKit/605.1.15"))
+	require.Equal("linux", detectPlatform("Mozilla/5.0 (X11; Linux x86_64; rv:63.0) Gecko/20100101 Firefox/63.0"))
+	require.Equal("", detectPlatform("curl/7.61.1"))
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("de-at", preferredLanguage("de-AT, en;q=0.8"))
+	require.Equal("fr", preferredLanguage("en;q=0.5, fr, *;q=0.1"))
+	require.Equal("en", preferredLanguage("is;q=0, en;q=0.3"))
+	require.Equal("", preferredLanguage(""))
+}
+
+func TestMatchRule(t *testing.T) {
+	require := require.New(t)
+
+	link := &Link{
+		URL: "https://example.com/",
+		Rules: []Rule{
+			{URL: "https://apps.apple.com/", Platforms: []string{"ios"}},
+			{URL: "https://example.de/", Languages: []string{"de"}},
+			{URL: "https://example.com/night", From: "22:00", To: "06:00"},
+		},
+	}
+
+	r, err := http.NewRequest("GET", "/", nil)
+	require.NoError(err)
+	noon := time.Date(2018, 11, 20, 12, 0, 0, 0, time.UTC)
+	require.Equal(-1, link.matchRule(r, noon))
+
+	r.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 12_1 like Mac OS X)")
+	require.Equal(0, link.matchRule(r, noon))
+
+	r.Header.Set("User-Agent", "")
+	r.Header.Set("Accept-Language", "de-CH, en;q=0.5")
+	require.Equal(1, link.matchRule(r, noon))
+
+	r.Header.Set("Accept-Language", "en")
+	require.Equal(2, link.matchRule(r, time.Date(2018, 11, 20, 23, 30, 0, 0, time.UTC)))
+	require.Equal(2, link.matchRule(r, time.Date(2018, 11, 20, 5, 59, 0, 0, time.UTC)))
+	require.Equal(-1, link.matchRule(r, time.Date(2018, 11, 20, 6, 0, 0, 0, time.UTC)))
+}
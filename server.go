@@ -5,10 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"io/ioutil"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/syntaqx/go-chi-render"
@@ -16,6 +22,9 @@ import (
 
 var db *DB
 
+var threats *ThreatList
+var geoip *GeoIP
+
 type contextKey struct{ name string }
 
 var templates map[string]*template.Template = make(map[string]*template.Template)
@@ -40,6 +49,20 @@ func ErrInternalServer(err error) render.Renderer {
 	}
 }
 
+func ErrForbidden(err error) render.Renderer {
+	return &ErrResponse{
+		Err:        err,
+		StatusCode: http.StatusForbidden,
+	}
+}
+
+func ErrUnauthorized(err error) render.Renderer {
+	return &ErrResponse{
+		Err:        err,
+		StatusCode: http.StatusUnauthorized,
+	}
+}
+
 func ErrNotFound(err error) render.Renderer {
 	return &ErrResponse{
 		Err:        err,
@@ -66,6 +89,29 @@ func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// PasswordPrompt is rendered in place of a link that needs a password
+type PasswordPrompt struct {
+	*ErrResponse
+	ID string `json:"id"`
+}
+
+// Unavailable is rendered in place of a link that can not be read
+type Unavailable struct {
+	*ErrResponse
+	ID string `json:"id"`
+	// Reason is one of "not_active", "disabled", "expired" or "exhausted"
+	Reason      string     `json:"reason"`
+	NotBefore   *time.Time `json:"not_before,omitempty"`
+	FallbackURL string     `json:"fallback_url,omitempty"`
+}
+
+var unavailableReasons = map[error]string{
+	ErrNotActive: "not_active",
+	ErrDisabled:  "disabled",
+	ErrExpired:   "expired",
+	ErrExhausted: "exhausted",
+}
+
 func CreateServer(dbURL string) (*chi.Mux, error) {
 	var err error
 	db, err = NewDB(dbURL)
@@ -76,6 +122,26 @@ func CreateServer(dbURL string) (*chi.Mux, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = db.Migrate(&Revision{})
+	if err != nil {
+		return nil, err
+	}
+
+	threats = nil
+	if config.ThreatListPath != "" {
+		threats, err = NewThreatList(config.ThreatListPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	geoip = nil
+	if config.GeoIPPath != "" {
+		geoip, err = NewGeoIP(config.GeoIPPath)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	render.Respond = Respond
 
@@ -86,93 +152,854 @@ func CreateServer(dbURL string) (*chi.Mux, error) {
 	})
 
 	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		owner, err := requestOwner(r)
+		if err != nil {
+			render.Render(w, r, ErrUnauthorized(err))
+			return
+		}
+
 		// Pass an empty string to simulate an "optional" argument
 		link := &Link{}
 
-		if err := render.Bind(r, link); err != nil {
+		if err := bindLink(r, link); err != nil {
 			render.Render(w, r, ErrInvalidRequest(err))
 			return
 		}
+		link.Owner = owner
+
+		// Links are only replaced through POST /{id}, which checks who owns
+		// them
+		if link.ID != "" {
+			exists, err := db.Exists(link)
+			if err != nil {
+				render.Render(w, r, ErrInternalServer(err))
+				return
+			}
+			if exists {
+				render.Render(w, r, ErrInvalidRequest(errors.New("Link "+link.ID+" already exists")))
+				return
+			}
+		}
+
+		if err := checkChain(r, link); err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		if err := checkAliases(link); err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+
+		if wantsDedupe(r) && !link.HasOptions() {
+			existing, err := findDuplicate(link)
+			if err != nil {
+				render.Render(w, r, ErrInternalServer(err))
+				return
+			}
+			if existing != nil {
+				w.Header().Set("Location", existing.URL)
+				render.Render(w, r, existing)
+				return
+			}
+		}
 
-		err := db.Save(link)
+		err = db.SaveAndRefresh(link)
 		if err != nil {
 			render.Render(w, r, ErrInternalServer(err))
+			return
+		}
+		if err := recordRevision(owner, "create", nil, link); err != nil {
+			render.Render(w, r, ErrInternalServer(err))
+			return
 		}
 
 		render.Status(r, http.StatusCreated)
-		w.Header().Set("Location", link.URL)
+		if link.URL != "" {
+			w.Header().Set("Location", link.URL)
+		}
 		render.Render(w, r, link)
 	})
 
+	r.Route("/api", func(r chi.Router) {
+		r.Use(render.SetContentType(render.ContentTypeJSON))
+
+		r.Get("/links", func(w http.ResponseWriter, r *http.Request) {
+			owner, err := requestOwner(r)
+			if err != nil || owner == "" {
+				render.Render(w, r, ErrUnauthorized(errors.New("Listing links needs an API key")))
+				return
+			}
+
+			query, err := linkQuery(r.URL.Query(), owner)
+			if err != nil {
+				render.Render(w, r, ErrInvalidRequest(err))
+				return
+			}
+
+			links, err := searchLinks(query)
+			if err != nil {
+				render.Render(w, r, ErrInternalServer(err))
+				return
+			}
+
+			list := make([]render.Renderer, len(links))
+			for i, link := range links {
+				if link.PasswordHash != "" || link.CanRead() == ErrNotActive {
+					link.hideDestination()
+				}
+				// Pastes are only shown to their visitors, so that hit limits
+				// and passwords hold
+				link.Content = ""
+				list[i] = link
+			}
+			render.RenderList(w, r, list)
+		})
+
+		r.Get("/links/{id}/history", func(w http.ResponseWriter, r *http.Request) {
+			owner, err := requestOwner(r)
+			if err != nil {
+				render.Render(w, r, ErrUnauthorized(err))
+				return
+			}
+
+			link, err := findLink(chi.URLParam(r, "id"))
+			if err != nil {
+				render.Render(w, r, ErrNotFound(errors.New("Link not found in database")))
+				return
+			}
+			if !link.EditableBy(owner) {
+				render.Render(w, r, ErrForbidden(errors.New("Link belongs to someone else")))
+				return
+			}
+			// Anyone may change anonymous links, but their history must not
+			// show what visitors can't see yet
+			if link.Owner == "" && (link.PasswordHash != "" || link.HitLimit > 0 || link.CanRead() != nil) {
+				render.Render(w, r, ErrForbidden(errors.New("History is only shown for links that anyone can visit")))
+				return
+			}
+
+			revisions, err := findRevisions(link.ID)
+			if err != nil {
+				render.Render(w, r, ErrInternalServer(err))
+				return
+			}
+
+			list := make([]render.Renderer, len(revisions))
+			for i, revision := range revisions {
+				list[i] = revision
+			}
+			render.RenderList(w, r, list)
+		})
+
+		r.Post("/links/{id}/history/{revision}/rollback", func(w http.ResponseWriter, r *http.Request) {
+			owner, err := requestOwner(r)
+			if err != nil {
+				render.Render(w, r, ErrUnauthorized(err))
+				return
+			}
+
+			link, err := findLink(chi.URLParam(r, "id"))
+			if err != nil || link.DeletedAt != nil {
+				render.Render(w, r, ErrNotFound(errors.New("Link not found in database")))
+				return
+			}
+			if !link.EditableBy(owner) {
+				render.Render(w, r, ErrForbidden(errors.New("Link belongs to someone else")))
+				return
+			}
+
+			revision, err := findRevision(link.ID, chi.URLParam(r, "revision"))
+			if err != nil {
+				render.Render(w, r, ErrNotFound(err))
+				return
+			}
+
+			patch, err := rollbackPatch(link, revision)
+			if err != nil {
+				render.Render(w, r, ErrInternalServer(err))
+				return
+			}
+			updated, err := link.Patch(r, patch)
+			if err != nil {
+				render.Render(w, r, ErrInvalidRequest(err))
+				return
+			}
+			if err := checkChain(r, updated); err != nil {
+				render.Render(w, r, ErrInvalidRequest(err))
+				return
+			}
+			if err := checkAliases(updated); err != nil {
+				render.Render(w, r, ErrInvalidRequest(err))
+				return
+			}
+
+			if err := db.SaveAndRefresh(updated); err != nil {
+				render.Render(w, r, ErrInternalServer(err))
+				return
+			}
+			if err := recordRevision(owner, "rollback", link, updated); err != nil {
+				render.Render(w, r, ErrInternalServer(err))
+				return
+			}
+
+			render.Render(w, r, updated)
+		})
+	})
+
 	r.Post("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		owner, err := requestOwner(r)
+		if err != nil {
+			render.Render(w, r, ErrUnauthorized(err))
+			return
+		}
+
 		link := &Link{
 			ID: chi.URLParam(r, "id"),
 		}
 
-		if err := render.Bind(r, link); err != nil {
+		if err := bindLink(r, link); err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		link.Owner = owner
+
+		if err := checkChain(r, link); err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		if err := checkAliases(link); err != nil {
 			render.Render(w, r, ErrInvalidRequest(err))
 			return
 		}
 
-		err := db.Save(link)
+		// Replacing a link is only allowed for its owner
+		existing := &Link{ID: link.ID}
+		if err := db.Get(existing); err == nil {
+			if !existing.EditableBy(owner) {
+				render.Render(w, r, ErrForbidden(errors.New("Link belongs to someone else")))
+				return
+			}
+			link.UpdatedAt = time.Now()
+		} else {
+			existing = nil
+		}
+
+		err = db.SaveAndRefresh(link)
 		if err != nil {
 			render.Render(w, r, ErrInternalServer(err))
+			return
+		}
+		action := "create"
+		if existing != nil {
+			action = "replace"
+		}
+		if err := recordRevision(owner, action, existing, link); err != nil {
+			render.Render(w, r, ErrInternalServer(err))
+			return
 		}
 
 		render.Status(r, http.StatusCreated)
-		w.Header().Set("Location", link.URL)
+		if link.URL != "" {
+			w.Header().Set("Location", link.URL)
+		}
 		render.Render(w, r, link)
 	})
 
-	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
-		ID := chi.URLParam(r, "id")
-		link := &Link{ID: ID}
-		err := db.Get(link)
+	redirect := func(w http.ResponseWriter, r *http.Request) {
+		link, err := findLink(chi.URLParam(r, "id"))
+		if err != nil {
+			render.Render(w, r, ErrNotFound(err))
+			return
+		}
+
+		if err := link.CanRead(); err != nil {
+			unavailable(w, r, link, err)
+			return
+		}
+
+		extraPath := chi.URLParam(r, "*")
+		templated := isTemplate(link.URL)
+		if extraPath != "" && !link.ForwardPath && !templated && !link.IsCollection() {
+			render.Render(w, r, ErrNotFound(errors.New("Link not found in database")))
+			return
+		}
+
+		if link.PasswordHash != "" && !unlock(w, r, link) {
+			return
+		}
+
+		if link.IsPaste() {
+			showPaste(w, r, link)
+			return
+		}
+		if link.IsEncrypted() {
+			showEncrypted(w, r, link)
+			return
+		}
+		if link.IsCollection() && extraPath == "" {
+			showCollection(w, r, link)
+			return
+		}
+
+		base := link.URL
+		variant, item := -1, -1
+		if link.IsCollection() {
+			if item = link.findItem(extraPath); item < 0 {
+				render.Render(w, r, ErrNotFound(errors.New("Item not found in collection")))
+				return
+			}
+			base = link.Items[item].URL
+		} else if rule := link.matchRule(r, time.Now()); rule >= 0 {
+			base = link.Rules[rule].URL
+		} else if variant = link.pickVariant(w, r); variant >= 0 {
+			base = link.Variants[variant].URL
+		}
 
-		if !link.CanRead() {
-			err = errors.New("Link not found in database")
+		var destination string
+		if templated {
+			destination, err = link.Expand(templateArgs(extraPath), r.URL.Query())
+			if err != nil {
+				render.Render(w, r, ErrInvalidRequest(err))
+				return
+			}
+		} else {
+			destination, err = link.Destination(base, extraPath, r.URL.Query())
+			if err != nil {
+				render.Render(w, r, ErrInternalServer(err))
+				return
+			}
 		}
 
+		destination, err = link.Tag(destination)
 		if err != nil {
-			render.Render(w, r, ErrNotFound(err))
+			render.Render(w, r, ErrInternalServer(err))
 			return
 		}
 
-		link.HitCount++
-		db.Save(link)
+		flagged := threats.Match(destination)
+		if flagged && config.ThreatAction == "block" {
+			render.Render(w, r, ErrForbidden(errors.New("Link destination is flagged as unsafe")))
+			return
+		}
+
+		// This is also a hit when an interstitial is shown instead, since it
+		// reveals the destination as well. Otherwise the destination of once
+		// links and links with a hit limit could be read again and again.
+		if variant >= 0 {
+			link.Variants[variant].Hits++
+		}
+		countHit(w, link, item)
+
+		// Show the destination this request is sent to from here on
+		link.URL = destination
 
-		// Only render with 302 status for non-JSON responses
+		if flagged {
+			render.Render(w, WithTemplate(r, "link.warning"), link)
+			return
+		}
+
+		hosts := append([]string{r.Host}, config.Hosts...)
+		if render.GetAcceptedContentType(r) != render.ContentTypeJSON &&
+			config.Interstitial.Needs(link, link.URL, hosts, time.Now()) {
+			w.Header().Set("Cache-Control", "no-store")
+			render.Render(w, WithTemplate(r, "link.interstitial"), &Interstitial{
+				Link:      link,
+				Countdown: config.Interstitial.Countdown,
+			})
+			return
+		}
+
+		// Only render with a redirect status for non-JSON responses
 		if render.GetAcceptedContentType(r) != render.ContentTypeJSON {
-			//render.Status(r, http.StatusFound)
+			if link.ReferrerPolicy != "" {
+				w.Header().Set("Referrer-Policy", link.ReferrerPolicy)
+			}
 			w.Header().Set("Location", link.URL)
-			w.WriteHeader(http.StatusFound)
+			w.WriteHeader(link.redirectStatus(r))
 		}
 		render.Render(w, WithTemplate(r, "link.view"), link)
+	}
+
+	r.Get("/{id}", redirect)
+	// Links that forward their path and template links are also reachable
+	// below their ID
+	r.Get("/{id}/*", redirect)
+	// The password prompt of protected links is submitted here
+	r.Post("/{id}/unlock", redirect)
+
+	r.Patch("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		owner, err := requestOwner(r)
+		if err != nil {
+			render.Render(w, r, ErrUnauthorized(err))
+			return
+		}
+
+		link, err := findLink(chi.URLParam(r, "id"))
+		if err != nil || link.DeletedAt != nil {
+			render.Render(w, r, ErrNotFound(errors.New("Link not found in database")))
+			return
+		}
+		if !link.EditableBy(owner) {
+			render.Render(w, r, ErrForbidden(errors.New("Link belongs to someone else")))
+			return
+		}
+
+		contentType := strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0])
+		if contentType != "application/merge-patch+json" && contentType != "application/json" {
+			render.Render(w, r, ErrInvalidRequest(errors.New("Patches must be JSON merge patches")))
+			return
+		}
+		patch, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPatchSize))
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+
+		updated, err := link.Patch(r, patch)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+
+		if err := checkChain(r, updated); err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		if err := checkAliases(updated); err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+
+		if err := db.SaveAndRefresh(updated); err != nil {
+			render.Render(w, r, ErrInternalServer(err))
+			return
+		}
+		if err := recordRevision(owner, "update", link, updated); err != nil {
+			render.Render(w, r, ErrInternalServer(err))
+			return
+		}
+
+		render.Render(w, r, updated)
 	})
 
-	r.Get("/{id}/preview", func(w http.ResponseWriter, r *http.Request) {
-		ID := chi.URLParam(r, "id")
-		link := &Link{ID: ID}
-		err := db.Get(link)
+	r.Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		owner, err := requestOwner(r)
+		if err != nil {
+			render.Render(w, r, ErrUnauthorized(err))
+			return
+		}
+
+		link, err := findLink(chi.URLParam(r, "id"))
+		if err != nil || link.DeletedAt != nil {
+			render.Render(w, r, ErrNotFound(errors.New("Link not found in database")))
+			return
+		}
+		if !link.EditableBy(owner) {
+			render.Render(w, r, ErrForbidden(errors.New("Link belongs to someone else")))
+			return
+		}
+
+		before := *link
+		now := time.Now()
+		link.DeletedAt = &now
+		if err := db.SaveAndRefresh(link); err != nil {
+			render.Render(w, r, ErrInternalServer(err))
+			return
+		}
+		if err := recordRevision(owner, "delete", &before, link); err != nil {
+			render.Render(w, r, ErrInternalServer(err))
+			return
+		}
+
+		render.Render(w, r, link)
+	})
+
+	r.Post("/{id}/restore", func(w http.ResponseWriter, r *http.Request) {
+		owner, err := requestOwner(r)
+		if err != nil {
+			render.Render(w, r, ErrUnauthorized(err))
+			return
+		}
+
+		link, err := findLink(chi.URLParam(r, "id"))
+		if err != nil || link.DeletedAt == nil || time.Since(*link.DeletedAt) > config.TrashPeriod {
+			render.Render(w, r, ErrNotFound(errors.New("Link not found in trash")))
+			return
+		}
+		if !link.EditableBy(owner) {
+			render.Render(w, r, ErrForbidden(errors.New("Link belongs to someone else")))
+			return
+		}
 
-		if !link.CanRead() {
-			err = errors.New("Link not found in database")
+		before := *link
+		link.DeletedAt = nil
+		if err := db.SaveAndRefresh(link); err != nil {
+			render.Render(w, r, ErrInternalServer(err))
+			return
+		}
+		if err := recordRevision(owner, "restore", &before, link); err != nil {
+			render.Render(w, r, ErrInternalServer(err))
+			return
 		}
 
+		render.Render(w, r, link)
+	})
+
+	r.Get("/{id}/preview", func(w http.ResponseWriter, r *http.Request) {
+		link, err := findLink(chi.URLParam(r, "id"))
 		if err != nil {
 			render.Render(w, r, ErrNotFound(err))
 			return
 		}
 
-		link.HitCount++
-		db.Save(link)
+		if err := link.CanRead(); err != nil {
+			unavailable(w, r, link, err)
+			return
+		}
+
+		if link.PasswordHash != "" && !unlock(w, r, link) {
+			return
+		}
+
+		// There is nothing to preview of a paste but the paste itself
+		if link.IsPaste() {
+			showPaste(w, r, link)
+			return
+		}
+
+		countHit(w, link, -1)
 
+		// Only the browser can tell where an encrypted link goes
+		if link.IsEncrypted() {
+			render.Render(w, WithTemplate(r, "link.decrypt"), link)
+			return
+		}
+		// Collections already show where their items go
+		if link.IsCollection() {
+			render.Render(w, WithTemplate(r, "link.collection"), link)
+			return
+		}
 		render.Render(w, WithTemplate(r, "link.preview"), link)
 	})
 
 	return r, nil
 }
 
+// queryBool reads a boolean query parameter that overrides a global setting
+func queryBool(r *http.Request, name string, fallback bool) bool {
+	if value, err := strconv.ParseBool(r.URL.Query().Get(name)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// wantsDedupe tells if a new link should reuse an existing link to the same
+// URL. The `dedupe` query parameter overrides the global setting.
+func wantsDedupe(r *http.Request) bool {
+	return queryBool(r, "dedupe", config.Dedupe)
+}
+
+// checkChain rejects links that would redirect back to themselves through
+// our own hosts. If asked to, links to other links are pointed straight at
+// the final destination.
+func checkChain(r *http.Request, link *Link) error {
+	hosts := append([]string{r.Host}, config.Hosts...)
+	flatten := queryBool(r, "flatten", config.FlattenChains)
+
+	// follow checks one of the destinations of the link
+	follow := func(destination *string) error {
+		resolved, err := resolveChain(&Link{ID: link.ID, Aliases: link.Aliases, URL: *destination}, hosts)
+		if err != nil {
+			return err
+		}
+		if flatten {
+			*destination = resolved
+		}
+		return nil
+	}
+
+	if err := follow(&link.URL); err != nil {
+		return err
+	}
+	if err := follow(&link.FallbackURL); err != nil {
+		return err
+	}
+	for i := range link.Variants {
+		if err := follow(&link.Variants[i].URL); err != nil {
+			return err
+		}
+	}
+	for i := range link.Rules {
+		if err := follow(&link.Rules[i].URL); err != nil {
+			return err
+		}
+	}
+	for i := range link.Items {
+		if err := follow(&link.Items[i].URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findDuplicate looks for a readable link without options that points to the
+// same URL as the given link
+func findDuplicate(link *Link) (*Link, error) {
+	normalized, err := normalizeURL(link.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only links that the caller could also change are reused
+	records, err := db.Search(link, map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"normalized_url": normalized}},
+					map[string]interface{}{"term": map[string]interface{}{"owner": link.Owner}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		existing := &Link{}
+		if err := record.Decode(existing); err != nil {
+			return nil, err
+		}
+		if existing.CanRead() == nil && !existing.HasOptions() {
+			return existing, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// linkQuery builds the search for listing the links of owner from query
+// parameters: `q`
+// searches the URL and metadata, every `tag` has to be on the link,
+// `disabled` only lists enabled or disabled links, `deleted=true` lists the
+// trash instead of the other links and `from` and `size` page through the
+// results, newest first
+func linkQuery(values url.Values, owner string) (map[string]interface{}, error) {
+	must := []interface{}{}
+	mustNot := []interface{}{}
+	if q := strings.TrimSpace(values.Get("q")); q != "" {
+		must = append(must, map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":  q,
+				"fields": []string{"url", "title", "description", "notes", "content", "items.title", "items.url"},
+			},
+		})
+	}
+
+	tags, err := normalizeTags(values["tag"])
+	if err != nil {
+		return nil, err
+	}
+	filter := []interface{}{
+		map[string]interface{}{
+			"term": map[string]interface{}{"owner": owner},
+		},
+	}
+	for _, tag := range tags {
+		filter = append(filter, map[string]interface{}{
+			"term": map[string]interface{}{"tags": tag},
+		})
+	}
+
+	inTrash := map[string]interface{}{
+		"exists": map[string]interface{}{"field": "deleted_at"},
+	}
+	if deleted, _ := strconv.ParseBool(values.Get("deleted")); deleted {
+		filter = append(filter, inTrash)
+	} else {
+		mustNot = append(mustNot, inTrash)
+	}
+
+	if s := values.Get("disabled"); s != "" {
+		disabled, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.New("Disabled must be true or false")
+		}
+		isDisabled := map[string]interface{}{
+			"term": map[string]interface{}{"disabled": true},
+		}
+		if disabled {
+			filter = append(filter, isDisabled)
+		} else {
+			mustNot = append(mustNot, isDisabled)
+		}
+	}
+
+	from, size := 0, 20
+	if s := values.Get("from"); s != "" {
+		if from, err = strconv.Atoi(s); err != nil || from < 0 {
+			return nil, errors.New("From must be a positive number")
+		}
+	}
+	if s := values.Get("size"); s != "" {
+		if size, err = strconv.Atoi(s); err != nil || size < 1 || size > 100 {
+			return nil, errors.New("Size must be between 1 and 100")
+		}
+	}
+
+	return map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must":     must,
+				"filter":   filter,
+				"must_not": mustNot,
+			},
+		},
+		"sort": []interface{}{
+			map[string]interface{}{"@timestamp": "desc"},
+		},
+		"from": from,
+		"size": size,
+	}, nil
+}
+
+// searchLinks returns the links found by an Elastic query
+func searchLinks(query interface{}) ([]*Link, error) {
+	records, err := db.Search(&Link{}, query)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]*Link, len(records))
+	for i, record := range records {
+		links[i] = &Link{}
+		if err := record.Decode(links[i]); err != nil {
+			return nil, err
+		}
+	}
+	return links, nil
+}
+
+// unavailable writes the response for a link that can not be read because
+// of the given reason. Links that are not active yet show a "coming soon"
+// page, other links redirect to their fallback URL if they have one or
+// explain why they are gone.
+func unavailable(w http.ResponseWriter, r *http.Request, link *Link, reason error) {
+	response := &Unavailable{
+		ID:     link.ID,
+		Reason: unavailableReasons[reason],
+	}
+	wantsJSON := render.GetAcceptedContentType(r) == render.ContentTypeJSON
+
+	if reason == ErrDeleted {
+		render.Render(w, r, ErrNotFound(errors.New("Link not found in database")))
+		return
+	}
+
+	if reason == ErrDisabled {
+		if config.DisabledURL != "" && !wantsJSON {
+			http.Redirect(w, r, config.DisabledURL, http.StatusFound)
+			return
+		}
+		response.ErrResponse = &ErrResponse{Err: reason, StatusCode: http.StatusNotFound}
+		render.Render(w, WithTemplate(r, "link.disabled"), response)
+		return
+	}
+
+	if reason == ErrNotActive {
+		if config.ComingSoonURL != "" && !wantsJSON {
+			http.Redirect(w, r, config.ComingSoonURL, http.StatusFound)
+			return
+		}
+		response.ErrResponse = &ErrResponse{Err: reason, StatusCode: http.StatusNotFound}
+		response.NotBefore = &link.NotBefore
+		render.Render(w, WithTemplate(r, "link.soon"), response)
+		return
+	}
+
+	if link.FallbackURL != "" && !wantsJSON {
+		http.Redirect(w, r, link.FallbackURL, http.StatusFound)
+		return
+	}
+	response.ErrResponse = &ErrResponse{Err: reason, StatusCode: config.GoneStatus}
+	response.FallbackURL = link.FallbackURL
+	render.Render(w, WithTemplate(r, "link.gone"), response)
+}
+
+// countHit saves a visit of the link, or of the collection item with the
+// given index when it is not -1, and sets how long the response may be
+// cached. Links with a hit limit must not be kept around.
+func countHit(w http.ResponseWriter, link *Link, item int) {
+	if item >= 0 {
+		// Visits of the collection page are the hits of the link itself
+		link.Items[item].Hits++
+	} else {
+		link.HitCount++
+	}
+	link.LastHit = time.Now()
+	db.Save(link)
+
+	if link.HitLimit > 0 {
+		w.Header().Set("Cache-Control", "no-store")
+	} else if link.CacheMaxAge > 0 {
+		w.Header().Set("Cache-Control", "max-age="+strconv.FormatInt(link.CacheMaxAge, 10))
+	}
+}
+
+// unlock checks the password given for a protected link. It can be sent in
+// the X-Link-Password header, with basic auth or from the password prompt.
+// When the password is missing or wrong a response is written and false is
+// returned.
+func unlock(w http.ResponseWriter, r *http.Request, link *Link) bool {
+	id := strings.ToLower(link.ID)
+	prompt := &PasswordPrompt{ID: link.ID}
+
+	if wait := throttle.Locked(id); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		prompt.ErrResponse = &ErrResponse{
+			Err:        errors.New("Too many wrong passwords, try again later"),
+			StatusCode: http.StatusTooManyRequests,
+		}
+		render.Render(w, WithTemplate(r, "link.password"), prompt)
+		return false
+	}
+
+	password := r.Header.Get("X-Link-Password")
+	if _, basic, ok := r.BasicAuth(); ok && password == "" {
+		password = basic
+	}
+	if password == "" && r.Method == "POST" {
+		password = r.PostFormValue("password")
+	}
+
+	if password == "" {
+		prompt.ErrResponse = &ErrResponse{
+			Err:        errors.New("Link requires a password"),
+			StatusCode: http.StatusUnauthorized,
+		}
+		render.Render(w, WithTemplate(r, "link.password"), prompt)
+		return false
+	}
+
+	ok, err := checkPassword(link.PasswordHash, password)
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		return false
+	}
+	if !ok {
+		throttle.Fail(id)
+		prompt.ErrResponse = &ErrResponse{
+			Err:        errors.New("Wrong password"),
+			StatusCode: http.StatusUnauthorized,
+		}
+		render.Render(w, WithTemplate(r, "link.password"), prompt)
+		return false
+	}
+
+	throttle.Reset(id)
+	return true
+}
+
 func Respond(w http.ResponseWriter, r *http.Request, v interface{}) {
 	// Format response based on request Accept header.
 	switch render.GetAcceptedContentType(r) {
@@ -182,6 +1009,9 @@ func Respond(w http.ResponseWriter, r *http.Request, v interface{}) {
 	case render.ContentTypeHTML:
 		if t, ok := r.Context().Value(templateKey).(string); ok {
 			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if status, ok := r.Context().Value(render.StatusCtxKey).(int); ok {
+				w.WriteHeader(status)
+			}
 			tpl := templates[t]
 			if tpl == nil {
 				render.Render(w, r, ErrInternalServer(errors.New("template "+t+" not found")))
@@ -219,10 +1049,16 @@ func main() {
 	if ESUrl == "" {
 		panic(errors.New("ES_URL needs to be set"))
 	}
+	var err error
+	config, err = LoadConfig()
+	if err != nil {
+		panic(err)
+	}
 	r, err := CreateServer(ESUrl)
 	if err != nil {
 		panic(err)
 	}
+	go purgeTrashEvery(purgeInterval)
 	fmt.Println("Up and running on port 3000!")
 	http.ListenAndServe(":3000", r)
 }
@@ -55,7 +55,7 @@ func InsertLinkIntoDB(link *Link) error {
 	if err != nil {
 		return err
 	}
-	err = db.Save(link)
+	err = db.SaveAndRefresh(link)
 	if err != nil {
 		return err
 	}
@@ -366,7 +366,7 @@ func TestLinkHitLimit(t *testing.T) {
 	req.Header.Set("Accept", "application/json")
 	resp, err := testClient.Do(req)
 	require.NoError(err)
-	require.Equal(404, resp.StatusCode)
+	require.Equal(410, resp.StatusCode)
 }
 
 func TestLinkHitLimitManual(t *testing.T) {
@@ -398,7 +398,7 @@ func TestLinkHitLimitManual(t *testing.T) {
 	req.Header.Set("Accept", "application/json")
 	resp, err = testClient.Do(req)
 	require.NoError(err)
-	require.Equal(404, resp.StatusCode)
+	require.Equal(410, resp.StatusCode)
 }
 
 func TestLinkExpires(t *testing.T) {
@@ -423,7 +423,7 @@ func TestLinkExpires(t *testing.T) {
 	req.Header.Set("Accept", "application/json")
 	resp, err := testClient.Do(req)
 	require.NoError(err)
-	require.Equal(404, resp.StatusCode)
+	require.Equal(410, resp.StatusCode)
 }
 
 func TestLinkExpiresManual(t *testing.T) {
@@ -448,5 +448,1401 @@ func TestLinkExpiresManual(t *testing.T) {
 	req.Header.Set("Accept", "application/json")
 	resp, err = testClient.Do(req)
 	require.NoError(err)
+	require.Equal(410, resp.StatusCode)
+}
+
+func TestLinkPostJSONDedupe(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	link := Link{ID: "dedupe", URL: "https://example.com/dedupe"}
+	err = InsertLinkIntoDB(&link)
+	require.NoError(err)
+
+	body := []byte(`{"url": "HTTPS://Example.com/dedupe"}`)
+	req, err := http.NewRequest("POST", server.URL+"/?dedupe=true", bytes.NewBuffer(body))
+	require.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := testClient.Do(req)
+	require.NoError(err)
+	require.Equal(200, resp.StatusCode)
+
+	var jsonResponse map[string]string
+	defer io.Copy(ioutil.Discard, resp.Body)
+	json.NewDecoder(resp.Body).Decode(&jsonResponse)
+
+	require.Equal("dedupe", jsonResponse["id"])
+	require.Equal("https://example.com/dedupe", jsonResponse["url"])
+
+	// Links of someone else are never handed out
+	config.APIKeys = map[string]string{"sam-key": "sam"}
+	defer func() { config.APIKeys = nil }()
+	owned := Link{ID: "owned-dedupe", URL: "https://example.com/owned", Owner: "sam"}
+	require.NoError(InsertLinkIntoDB(&owned))
+
+	post := func(key, id string) *http.Response {
+		req, err := http.NewRequest("POST", server.URL+"/?dedupe=true", bytes.NewBufferString(`{"id": "`+id+`", "url": "https://example.com/owned"}`))
+		require.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		resp, err := testClient.Do(req)
+		require.NoError(err)
+		return resp
+	}
+	resp = post("", "copy")
+	require.Equal(201, resp.StatusCode)
+	resp = post("sam-key", "other-copy")
+	require.Equal(200, resp.StatusCode)
+	jsonResponse = nil
+	json.NewDecoder(resp.Body).Decode(&jsonResponse)
+	require.Equal("owned-dedupe", jsonResponse["id"])
+}
+
+func TestLinkPostJSONSchemeNotAllowed(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	json := []byte(`{"url": "javascript://x/%0aalert(1)"}`)
+	resp, err := http.Post(server.URL+"/new-link", "application/json", bytes.NewBuffer(json))
+	require.NoError(err)
+	require.Equal(400, resp.StatusCode)
+}
+
+func TestLinkPostRedirectLoop(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	config.Hosts = []string{"sho.rt"}
+	defer func() { config.Hosts = nil }()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	json := []byte(`{"url": "https://sho.rt/loop-a"}`)
+	resp, err := http.Post(server.URL+"/loop-a", "application/json", bytes.NewBuffer(json))
+	require.NoError(err)
+	require.Equal(400, resp.StatusCode)
+
+	link := Link{ID: "loop-b", URL: "https://sho.rt/loop-c"}
+	err = InsertLinkIntoDB(&link)
+	require.NoError(err)
+
+	json = []byte(`{"url": "https://sho.rt/loop-b"}`)
+	resp, err = http.Post(server.URL+"/loop-c", "application/json", bytes.NewBuffer(json))
+	require.NoError(err)
+	require.Equal(400, resp.StatusCode)
+}
+
+func TestLinkPostFlattenChain(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	config.Hosts = []string{"sho.rt"}
+	defer func() { config.Hosts = nil }()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	link := Link{ID: "chain-b", URL: "https://example.com/final"}
+	err = InsertLinkIntoDB(&link)
+	require.NoError(err)
+
+	body := []byte(`{"url": "https://sho.rt/chain-b"}`)
+	req, err := http.NewRequest("POST", server.URL+"/chain-a?flatten=true", bytes.NewBuffer(body))
+	require.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := testClient.Do(req)
+	require.NoError(err)
+	require.Equal(201, resp.StatusCode)
+
+	var jsonResponse map[string]string
+	defer io.Copy(ioutil.Discard, resp.Body)
+	json.NewDecoder(resp.Body).Decode(&jsonResponse)
+
+	require.Equal("https://example.com/final", jsonResponse["url"])
+	require.Equal("https://sho.rt/chain-b", jsonResponse["original_url"])
+}
+
+func TestLinkGetFlagged(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	file, err := ioutil.TempFile("", "threats")
+	require.NoError(err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("malware.example\n")
+	require.NoError(err)
+	require.NoError(file.Close())
+
+	config.ThreatListPath = file.Name()
+	defer func() { config.ThreatListPath = "" }()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	link := Link{ID: "flagged", URL: "https://malware.example/"}
+	err = InsertLinkIntoDB(&link)
+	require.NoError(err)
+
+	resp, err := testClient.Get(server.URL + "/flagged")
+	require.NoError(err)
+	require.Equal(403, resp.StatusCode)
+
+	json := []byte(`{"url": "https://malware.example/"}`)
+	resp, err = http.Post(server.URL+"/flagged-new", "application/json", bytes.NewBuffer(json))
+	require.NoError(err)
+	require.Equal(400, resp.StatusCode)
+
+	config.ThreatAction = "warn"
+	defer func() { config.ThreatAction = "block" }()
+
+	req, err := http.NewRequest("GET", server.URL+"/flagged", nil)
+	require.NoError(err)
+	req.Header.Set("Accept", "text/html")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	require.Equal(200, resp.StatusCode)
+	require.Equal("", resp.Header.Get("Location"))
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Regexp("flagged as unsafe", string(bodyBytes))
+}
+
+func TestLinkPassword(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	body := []byte(`{"url": "https://example.com/secret", "password": "hunter2"}`)
+	req, err := http.NewRequest("POST", server.URL+"/secret", bytes.NewBuffer(body))
+	require.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := testClient.Do(req)
+	require.NoError(err)
+	require.Equal(201, resp.StatusCode)
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.NotContains(string(bodyBytes), "hunter2")
+
+	req, err = http.NewRequest("GET", server.URL+"/secret", nil)
+	require.NoError(err)
+	req.Header.Set("Accept", "application/json")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	require.Equal(401, resp.StatusCode)
+	bodyBytes, err = ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.NotContains(string(bodyBytes), "example.com")
+
+	req, err = http.NewRequest("GET", server.URL+"/secret", nil)
+	require.NoError(err)
+	req.Header.Set("Accept", "text/html")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	require.Equal(401, resp.StatusCode)
+	bodyBytes, err = ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Regexp(`<form method="post" action="/secret/unlock">`, string(bodyBytes))
+
+	req, err = http.NewRequest("GET", server.URL+"/secret", nil)
+	require.NoError(err)
+	req.Header.Set("X-Link-Password", "hunter2")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	require.Equal(302, resp.StatusCode)
+	require.Equal("https://example.com/secret", resp.Header.Get("Location"))
+
+	req, err = http.NewRequest("GET", server.URL+"/secret", nil)
+	require.NoError(err)
+	req.SetBasicAuth("", "hunter2")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	require.Equal(302, resp.StatusCode)
+
+	resp, err = testClient.PostForm(server.URL+"/secret/unlock", url.Values{"password": {"hunter2"}})
+	require.NoError(err)
+	require.Equal(303, resp.StatusCode)
+	require.Equal("https://example.com/secret", resp.Header.Get("Location"))
+}
+
+func TestLinkPasswordThrottle(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	link := Link{ID: "throttled", URL: "https://example.com", Password: "hunter2"}
+	err = InsertLinkIntoDB(&link)
+	require.NoError(err)
+
+	for i := 0; i < config.PasswordAttempts; i++ {
+		req, err := http.NewRequest("GET", server.URL+"/throttled", nil)
+		require.NoError(err)
+		req.Header.Set("X-Link-Password", "wrong")
+		resp, err := testClient.Do(req)
+		require.NoError(err)
+		require.Equal(401, resp.StatusCode)
+	}
+
+	req, err := http.NewRequest("GET", server.URL+"/throttled", nil)
+	require.NoError(err)
+	req.Header.Set("X-Link-Password", "hunter2")
+	resp, err := testClient.Do(req)
+	require.NoError(err)
+	require.Equal(429, resp.StatusCode)
+	require.NotEmpty(resp.Header.Get("Retry-After"))
+}
+
+func TestLinkNotActive(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	date := time.Date(2999, time.January, 1, 12, 0, 0, 0, time.UTC)
+	link := Link{ID: "launch", URL: "https://example.com/launch", NotBefore: date}
+	err = InsertLinkIntoDB(&link)
+	require.NoError(err)
+
+	req, err := http.NewRequest("GET", server.URL+"/launch", nil)
+	require.NoError(err)
+	req.Header.Set("Accept", "application/json")
+	resp, err := testClient.Do(req)
+	require.NoError(err)
+	require.Equal(404, resp.StatusCode)
+
+	var jsonResponse map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&jsonResponse)
+	require.Equal("Link is not active yet", jsonResponse["error"])
+	require.Equal("2999-01-01T12:00:00Z", jsonResponse["not_before"])
+
+	req, err = http.NewRequest("GET", server.URL+"/launch", nil)
+	require.NoError(err)
+	req.Header.Set("Accept", "text/html")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
 	require.Equal(404, resp.StatusCode)
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	body := string(bodyBytes[:])
+	require.Regexp("coming soon", body)
+	require.NotContains(body, "https://example.com/launch")
+}
+
+func TestLinkPostOnce(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	json := []byte(`{"url": "https://example.com", "once": true, "expires_in": "1d"}`)
+	resp, err := http.Post(server.URL+"/once", "application/json", bytes.NewBuffer(json))
+	require.NoError(err)
+	require.Equal(201, resp.StatusCode)
+
+	resp, err = testClient.Get(server.URL + "/once")
+	require.NoError(err)
+	require.Equal(302, resp.StatusCode)
+
+	resp, err = testClient.Get(server.URL + "/once")
+	require.NoError(err)
+	require.Equal(410, resp.StatusCode)
+
+	json = []byte(`{"url": "https://example.com", "expires_in": "soon"}`)
+	resp, err = http.Post(server.URL+"/once", "application/json", bytes.NewBuffer(json))
+	require.NoError(err)
+	require.Equal(400, resp.StatusCode)
+}
+
+func TestLinkGone(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	date := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	link := Link{ID: "gone", URL: "https://example.com", Expires: date}
+	err = InsertLinkIntoDB(&link)
+	require.NoError(err)
+
+	req, err := http.NewRequest("GET", server.URL+"/gone", nil)
+	require.NoError(err)
+	req.Header.Set("Accept", "text/html")
+	resp, err := testClient.Do(req)
+	require.NoError(err)
+	require.Equal(410, resp.StatusCode)
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal("<!DOCTYPE html>\n<p>\n  This link has expired.\n</p>\n", string(bodyBytes[:]))
+
+	link = Link{ID: "gone-fallback", URL: "https://example.com", HitLimit: 1, HitCount: 1, FallbackURL: "https://example.com/sold-out"}
+	err = InsertLinkIntoDB(&link)
+	require.NoError(err)
+
+	resp, err = testClient.Get(server.URL + "/gone-fallback")
+	require.NoError(err)
+	require.Equal(302, resp.StatusCode)
+	require.Equal("https://example.com/sold-out", resp.Header.Get("Location"))
+
+	req, err = http.NewRequest("GET", server.URL+"/gone-fallback", nil)
+	require.NoError(err)
+	req.Header.Set("Accept", "application/json")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	require.Equal(410, resp.StatusCode)
+
+	var jsonResponse map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&jsonResponse)
+	require.Equal("exhausted", jsonResponse["reason"])
+	require.Equal("https://example.com/sold-out", jsonResponse["fallback_url"])
+
+	body := []byte(`{"url": "https://example.com/", "fallback_url": "` + server.URL + `/gone-loop"}`)
+	resp, err = http.Post(server.URL+"/gone-loop", "application/json", bytes.NewBuffer(body))
+	require.NoError(err)
+	require.Equal(400, resp.StatusCode)
+
+	config.Hosts = []string{"sho.rt"}
+	defer func() { config.Hosts = nil }()
+	link = Link{ID: "gone-back", URL: "https://example.com", Expires: date, FallbackURL: "https://sho.rt/gone-next"}
+	err = InsertLinkIntoDB(&link)
+	require.NoError(err)
+	body = []byte(`{"url": "https://sho.rt/gone-back"}`)
+	resp, err = http.Post(server.URL+"/gone-next", "application/json", bytes.NewBuffer(body))
+	require.NoError(err)
+	require.Equal(400, resp.StatusCode)
+}
+
+func TestLinkRedirectStatus(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	json := []byte(`{"url": "https://example.com", "redirect_status": 301, "cache_max_age": 86400, "referrer_policy": "no-referrer"}`)
+	resp, err := http.Post(server.URL+"/vanity", "application/json", bytes.NewBuffer(json))
+	require.NoError(err)
+	require.Equal(201, resp.StatusCode)
+
+	resp, err = testClient.Get(server.URL + "/vanity")
+	require.NoError(err)
+	require.Equal(301, resp.StatusCode)
+	require.Equal("https://example.com/", resp.Header.Get("Location"))
+	require.Equal("max-age=86400", resp.Header.Get("Cache-Control"))
+	require.Equal("no-referrer", resp.Header.Get("Referrer-Policy"))
+
+	json = []byte(`{"url": "https://example.com", "redirect_status": 200}`)
+	resp, err = http.Post(server.URL+"/vanity", "application/json", bytes.NewBuffer(json))
+	require.NoError(err)
+	require.Equal(400, resp.StatusCode)
+}
+
+func TestLinkForwardPathAndQuery(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	link := Link{ID: "docs", URL: "https://example.com/docs", ForwardPath: true, ForwardQuery: true}
+	err = InsertLinkIntoDB(&link)
+	require.NoError(err)
+
+	resp, err := testClient.Get(server.URL + "/docs/api/v2?tab=auth")
+	require.NoError(err)
+	require.Equal(302, resp.StatusCode)
+	require.Equal("https://example.com/docs/api/v2?tab=auth", resp.Header.Get("Location"))
+
+	link = Link{ID: "closed", URL: "https://example.com/closed"}
+	err = InsertLinkIntoDB(&link)
+	require.NoError(err)
+
+	resp, err = testClient.Get(server.URL + "/closed/api?tab=auth")
+	require.NoError(err)
+	require.Equal(404, resp.StatusCode)
+
+	resp, err = testClient.Get(server.URL + "/closed?tab=auth")
+	require.NoError(err)
+	require.Equal(302, resp.StatusCode)
+	require.Equal("https://example.com/closed", resp.Header.Get("Location"))
+}
+
+func TestLinkTemplate(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	json := []byte(`{"url": "https://GitHub.com/{org}/{repo}"}`)
+	resp, err := http.Post(server.URL+"/gh", "application/json", bytes.NewBuffer(json))
+	require.NoError(err)
+	require.Equal(201, resp.StatusCode)
+
+	resp, err = testClient.Get(server.URL + "/gh/golang/go")
+	require.NoError(err)
+	require.Equal(302, resp.StatusCode)
+	require.Equal("https://github.com/golang/go", resp.Header.Get("Location"))
+
+	resp, err = testClient.Get(server.URL + "/gh/golang")
+	require.NoError(err)
+	require.Equal(400, resp.StatusCode)
+
+	json = []byte(`{"url": "https://{1}.example.com/"}`)
+	resp, err = http.Post(server.URL+"/gh", "application/json", bytes.NewBuffer(json))
+	require.NoError(err)
+	require.Equal(400, resp.StatusCode)
+}
+
+func TestLinkCampaign(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	json := []byte(`{"url": "https://example.com/sale", "campaign": {"utm_source": "newsletter", "utm_campaign": "spring"}}`)
+	resp, err := http.Post(server.URL+"/sale", "application/json", bytes.NewBuffer(json))
+	require.NoError(err)
+	require.Equal(201, resp.StatusCode)
+
+	resp, err = testClient.Get(server.URL + "/sale")
+	require.NoError(err)
+	require.Equal(302, resp.StatusCode)
+	require.Equal("https://example.com/sale?utm_campaign=spring&utm_source=newsletter", resp.Header.Get("Location"))
+}
+
+func TestLinkVariants(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	body := []byte(`{"variants": [{"url": "https://example.com/a", "weight": 1}, {"url": "https://example.com/b", "weight": 3}]}`)
+	req, err := http.NewRequest("POST", server.URL+"/split", bytes.NewBuffer(body))
+	require.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := testClient.Do(req)
+	require.NoError(err)
+	require.Equal(201, resp.StatusCode)
+
+	var link Link
+	json.NewDecoder(resp.Body).Decode(&link)
+	require.Equal("https://example.com/a", link.URL)
+	require.Len(link.Variants, 2)
+	require.Equal(int64(3), link.Variants[1].Weight)
+
+	resp, err = testClient.Get(server.URL + "/split")
+	require.NoError(err)
+	require.Equal(302, resp.StatusCode)
+	location := resp.Header.Get("Location")
+	require.Contains([]string{"https://example.com/a", "https://example.com/b"}, location)
+	cookies := resp.Cookies()
+	require.Len(cookies, 1)
+	require.Equal("/", cookies[0].Path)
+
+	req, err = http.NewRequest("GET", server.URL+"/split", nil)
+	require.NoError(err)
+	req.AddCookie(cookies[0])
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	require.Equal(302, resp.StatusCode)
+	require.Equal(location, resp.Header.Get("Location"))
+
+	for _, variants := range []string{
+		`[{"url": "https://example.com/a", "weight": 0}]`,
+		`[{"url": "https://example.com/a", "weight": 9223372036854775807}, {"url": "https://example.com/b", "weight": 1}]`,
+		`[{"url": "https://example.com/a", "weight": 1}, {"url": "` + server.URL + `/split", "weight": 1}]`,
+	} {
+		body = []byte(`{"variants": ` + variants + `}`)
+		resp, err = http.Post(server.URL+"/split", "application/json", bytes.NewBuffer(body))
+		require.NoError(err)
+		require.Equal(400, resp.StatusCode, variants)
+	}
+}
+
+func TestLinkRules(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	body := []byte(`{"url": "https://example.com/", "rules": [{"url": "https://apps.apple.com/app", "platforms": ["iOS"]}]}`)
+	req, err := http.NewRequest("POST", server.URL+"/app", bytes.NewBuffer(body))
+	require.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := testClient.Do(req)
+	require.NoError(err)
+	require.Equal(201, resp.StatusCode)
+
+	var link Link
+	json.NewDecoder(resp.Body).Decode(&link)
+	require.Len(link.Rules, 1)
+	require.Equal([]string{"ios"}, link.Rules[0].Platforms)
+
+	req, err = http.NewRequest("GET", server.URL+"/app", nil)
+	require.NoError(err)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 12_1 like Mac OS X)")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	require.Equal(302, resp.StatusCode)
+	require.Equal("https://apps.apple.com/app", resp.Header.Get("Location"))
+
+	req, err = http.NewRequest("GET", server.URL+"/app", nil)
+	require.NoError(err)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Linux; Android 9; Pixel 3)")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	require.Equal(302, resp.StatusCode)
+	require.Equal("https://example.com/", resp.Header.Get("Location"))
+
+	body = []byte(`{"url": "https://example.com/", "rules": [{"url": "https://example.com/", "platforms": ["beos"]}]}`)
+	resp, err = http.Post(server.URL+"/app", "application/json", bytes.NewBuffer(body))
+	require.NoError(err)
+	require.Equal(400, resp.StatusCode)
+
+	body = []byte(`{"url": "https://example.com/", "rules": [{"url": "` + server.URL + `/app", "platforms": ["ios"]}]}`)
+	resp, err = http.Post(server.URL+"/app", "application/json", bytes.NewBuffer(body))
+	require.NoError(err)
+	require.Equal(400, resp.StatusCode)
+}
+
+func TestLinkCountryRules(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	config.GeoIPPath = "fixtures/geoip/country.mmdb"
+	config.TrustedProxies, err = parseNetworks([]string{"127.0.0.1"})
+	require.NoError(err)
+	defer func() {
+		config.GeoIPPath = ""
+		config.TrustedProxies = nil
+	}()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	body := []byte(`{"url": "https://example.com/", "rules": [{"url": "https://example.se/", "countries": ["se"]}]}`)
+	resp, err := http.Post(server.URL+"/shop", "application/json", bytes.NewBuffer(body))
+	require.NoError(err)
+	require.Equal(201, resp.StatusCode)
+
+	req, err := http.NewRequest("GET", server.URL+"/shop", nil)
+	require.NoError(err)
+	req.Header.Set("X-Forwarded-For", "89.160.20.112")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	require.Equal(302, resp.StatusCode)
+	require.Equal("https://example.se/", resp.Header.Get("Location"))
+
+	req.Header.Set("X-Forwarded-For", "81.2.69.142")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	require.Equal(302, resp.StatusCode)
+	require.Equal("https://example.com/", resp.Header.Get("Location"))
+}
+
+func TestLinkMetadata(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	config.APIKeys = map[string]string{"sam-key": "sam", "kim-key": "kim"}
+	defer func() { config.APIKeys = nil }()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	body := []byte(`{"url": "https://example.com/docs", "title": "Docs", "description": "Our documentation", "notes": "Ask Sam before changing", "tags": ["Team", "docs", "team"]}`)
+	req, err := http.NewRequest("POST", server.URL+"/docs", bytes.NewBuffer(body))
+	require.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer sam-key")
+	resp, err := testClient.Do(req)
+	require.NoError(err)
+	require.Equal(201, resp.StatusCode)
+
+	var link Link
+	json.NewDecoder(resp.Body).Decode(&link)
+	require.Equal("Docs", link.Title)
+	require.Equal([]string{"team", "docs"}, link.Tags)
+	require.Equal("Ask Sam before changing", link.Notes)
+	require.Equal("sam", link.Owner)
+
+	body = []byte(`{"url": "https://example.com/blog", "title": "Blog", "tags": ["team"]}`)
+	req, err = http.NewRequest("POST", server.URL+"/blog", bytes.NewBuffer(body))
+	require.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sam-key")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	require.Equal(201, resp.StatusCode)
+
+	req, err = http.NewRequest("GET", server.URL+"/docs/preview", nil)
+	require.NoError(err)
+	req.Header.Set("Accept", "text/html")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	require.Equal(200, resp.StatusCode)
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Contains(string(bodyBytes), "<h1>Docs</h1>")
+	require.Contains(string(bodyBytes), "<li>docs</li>")
+	require.NotContains(string(bodyBytes), "Sam")
+
+	list := func(query, key string) *http.Response {
+		req, err := http.NewRequest("GET", server.URL+"/api/links?"+query, nil)
+		require.NoError(err)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		resp, err := testClient.Do(req)
+		require.NoError(err)
+		return resp
+	}
+
+	var links []Link
+	resp = list("tag=team", "sam-key")
+	require.Equal(200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&links)
+	require.Len(links, 2)
+
+	links = nil
+	resp = list("tag=team&tag=docs", "sam-key")
+	json.NewDecoder(resp.Body).Decode(&links)
+	require.Len(links, 1)
+	require.Equal("docs", links[0].ID)
+	require.Equal("Ask Sam before changing", links[0].Notes)
+
+	links = nil
+	resp = list("q=changing", "sam-key")
+	json.NewDecoder(resp.Body).Decode(&links)
+	require.Len(links, 1)
+	require.Equal("docs", links[0].ID)
+
+	req, err = http.NewRequest("GET", server.URL+"/docs/preview", nil)
+	require.NoError(err)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer kim-key")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	link = Link{}
+	json.NewDecoder(resp.Body).Decode(&link)
+	require.Equal("Docs", link.Title)
+	require.Empty(link.Notes)
+	require.Empty(link.Owner)
+
+	links = nil
+	resp = list("q=blog", "sam-key")
+	json.NewDecoder(resp.Body).Decode(&links)
+	require.Len(links, 1)
+	require.Equal("blog", links[0].ID)
+
+	resp = list("size=1000", "sam-key")
+	require.Equal(400, resp.StatusCode)
+
+	resp = list("tag=team", "")
+	require.Equal(401, resp.StatusCode)
+
+	links = nil
+	resp = list("tag=team", "kim-key")
+	require.Equal(200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&links)
+	require.Len(links, 0)
+
+	body = []byte(`{"url": "https://example.com/secret", "tags": ["locked"], "password": "hunter2"}`)
+	req, err = http.NewRequest("POST", server.URL+"/locked", bytes.NewBuffer(body))
+	require.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sam-key")
+	resp, err = testClient.Do(req)
+	require.NoError(err)
+	require.Equal(201, resp.StatusCode)
+
+	links = nil
+	resp = list("tag=locked", "sam-key")
+	json.NewDecoder(resp.Body).Decode(&links)
+	require.Len(links, 1)
+	require.Empty(links[0].URL)
+}
+
+func TestLinkPatch(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	config.APIKeys = map[string]string{"sam-key": "sam", "kim-key": "kim"}
+	defer func() { config.APIKeys = nil }()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	send := func(method, path, key, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		require.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		resp, err := testClient.Do(req)
+		require.NoError(err)
+		return resp
+	}
+
+	resp := send("POST", "/owned", "sam-key", `{"url": "https://example.com/", "title": "Example"}`)
+	require.Equal(201, resp.StatusCode)
+	var link Link
+	json.NewDecoder(resp.Body).Decode(&link)
+	require.Equal("sam", link.Owner)
+	stored := &Link{ID: "owned"}
+	require.NoError(db.Get(stored))
+	require.Equal("sam", stored.Owner)
+
+	resp = send("GET", "/owned", "", "")
+	require.Equal(200, resp.StatusCode)
+
+	resp = send("PATCH", "/owned", "wrong-key", `{"url": "https://example.org/"}`)
+	require.Equal(401, resp.StatusCode)
+	resp = send("PATCH", "/owned", "kim-key", `{"url": "https://example.org/"}`)
+	require.Equal(403, resp.StatusCode)
+	resp = send("POST", "/owned", "", `{"url": "https://example.org/"}`)
+	require.Equal(403, resp.StatusCode)
+	resp = send("POST", "/", "kim-key", `{"id": "owned", "url": "https://example.org/"}`)
+	require.Equal(400, resp.StatusCode)
+	resp = send("POST", "/", "", `{"id": "owned", "url": "https://example.org/"}`)
+	require.Equal(400, resp.StatusCode)
+
+	resp = send("PATCH", "/owned", "sam-key", `{"url": "https://example.org/"}`)
+	require.Equal(200, resp.StatusCode)
+	link = Link{}
+	json.NewDecoder(resp.Body).Decode(&link)
+	require.Equal("https://example.org/", link.URL)
+	require.Equal("Example", link.Title)
+	require.False(link.UpdatedAt.IsZero())
+
+	stored = &Link{ID: "owned"}
+	require.NoError(db.Get(stored))
+	require.Equal(int64(1), stored.HitCount)
+
+	resp = send("PATCH", "/missing", "sam-key", `{"url": "https://example.org/"}`)
+	require.Equal(404, resp.StatusCode)
+}
+
+func TestLinkTrash(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	config.APIKeys = map[string]string{"sam-key": "sam", "kim-key": "kim"}
+	defer func() { config.APIKeys = nil }()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	send := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		require.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer sam-key")
+		resp, err := testClient.Do(req)
+		require.NoError(err)
+		return resp
+	}
+	listAs := func(key, query string) []Link {
+		var links []Link
+		req, err := http.NewRequest("GET", server.URL+"/api/links?"+query, nil)
+		require.NoError(err)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := testClient.Do(req)
+		require.NoError(err)
+		require.Equal(200, resp.StatusCode)
+		json.NewDecoder(resp.Body).Decode(&links)
+		return links
+	}
+	list := func(query string) []Link {
+		return listAs("sam-key", query)
+	}
+
+	resp := send("POST", "/temp", `{"url": "https://example.com/", "tags": ["trash"]}`)
+	require.Equal(201, resp.StatusCode)
+
+	resp = send("PATCH", "/temp", `{"disabled": true}`)
+	require.Equal(200, resp.StatusCode)
+	resp = send("GET", "/temp", "")
+	require.Equal(404, resp.StatusCode)
+	require.Len(list("tag=trash&disabled=true"), 1)
+
+	resp = send("PATCH", "/temp", `{"disabled": false}`)
+	require.Equal(200, resp.StatusCode)
+	resp = send("GET", "/temp", "")
+	require.Equal(302, resp.StatusCode)
+
+	resp = send("DELETE", "/temp", "")
+	require.Equal(200, resp.StatusCode)
+	resp = send("GET", "/temp", "")
+	require.Equal(404, resp.StatusCode)
+	resp = send("PATCH", "/temp", `{"title": "Temp"}`)
+	require.Equal(404, resp.StatusCode)
+	require.Len(list("tag=trash"), 0)
+	require.Len(list("tag=trash&deleted=true"), 1)
+	require.Len(listAs("kim-key", "tag=trash&deleted=true"), 0)
+
+	resp = send("POST", "/temp/restore", "")
+	require.Equal(200, resp.StatusCode)
+	resp = send("GET", "/temp", "")
+	require.Equal(302, resp.StatusCode)
+	require.Len(list("tag=trash"), 1)
+
+	resp = send("DELETE", "/temp", "")
+	require.Equal(200, resp.StatusCode)
+	purged, err := purgeTrash(time.Now().Add(config.TrashPeriod + time.Hour))
+	require.NoError(err)
+	require.Equal(1, purged)
+	resp = send("POST", "/temp/restore", "")
+	require.Equal(404, resp.StatusCode)
+}
+
+func TestLinkHistory(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	config.APIKeys = map[string]string{"sam-key": "sam", "kim-key": "kim"}
+	config.Hosts = []string{"sho.rt"}
+	defer func() {
+		config.APIKeys = nil
+		config.Hosts = nil
+	}()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	sendAs := func(key, method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		require.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		resp, err := testClient.Do(req)
+		require.NoError(err)
+		return resp
+	}
+	send := func(method, path, body string) *http.Response {
+		return sendAs("sam-key", method, path, body)
+	}
+	history := func() []Revision {
+		var revisions []Revision
+		resp := send("GET", "/api/links/shared/history", "")
+		require.Equal(200, resp.StatusCode)
+		json.NewDecoder(resp.Body).Decode(&revisions)
+		return revisions
+	}
+
+	resp := send("POST", "/shared", `{"url": "https://example.com/", "limit": 10, "aliases": ["common"]}`)
+	require.Equal(201, resp.StatusCode)
+	resp = send("PATCH", "/shared", `{"url": "https://example.org/", "title": "Shared"}`)
+	require.Equal(200, resp.StatusCode)
+
+	revisions := history()
+	require.Len(revisions, 2)
+	require.Equal("update", revisions[0].Action)
+	require.Equal("sam", revisions[0].Author)
+	require.Equal([]string{"original_url", "title", "url"}, revisions[0].Changed)
+	require.Equal("https://example.com/", revisions[0].Before["url"])
+	require.Equal("https://example.org/", revisions[0].After["url"])
+	require.NotContains(revisions[0].After, "limit")
+	require.Equal("create", revisions[1].Action)
+
+	resp = sendAs("", "GET", "/api/links/shared/history", "")
+	require.Equal(403, resp.StatusCode)
+	resp = sendAs("kim-key", "GET", "/api/links/shared/history", "")
+	require.Equal(403, resp.StatusCode)
+	resp = send("GET", "/api/links/common/history", "")
+	require.Equal(200, resp.StatusCode)
+	var aliased []Revision
+	json.NewDecoder(resp.Body).Decode(&aliased)
+	require.Len(aliased, 2)
+
+	resp = send("POST", "/api/links/shared/history/"+revisions[1].ID+"/rollback", "")
+	require.Equal(200, resp.StatusCode)
+	var link Link
+	json.NewDecoder(resp.Body).Decode(&link)
+	require.Equal("https://example.com/", link.URL)
+	require.Equal("", link.Title)
+
+	stored := &Link{ID: "shared"}
+	require.NoError(db.Get(stored))
+	require.Equal(int64(10), stored.HitLimit)
+
+	revisions = history()
+	require.Len(revisions, 3)
+	require.Equal("rollback", revisions[0].Action)
+
+	resp = send("POST", "/api/links/shared/history/missing/rollback", "")
+	require.Equal(404, resp.StatusCode)
+
+	// Rolling back must not make a link part of a loop
+	resp = send("POST", "/ping", `{"url": "https://sho.rt/pong"}`)
+	require.Equal(201, resp.StatusCode)
+	resp = send("PATCH", "/ping", `{"url": "https://example.com/ping"}`)
+	require.Equal(200, resp.StatusCode)
+	resp = send("POST", "/pong", `{"url": "https://sho.rt/ping"}`)
+	require.Equal(201, resp.StatusCode)
+	var pings []Revision
+	resp = send("GET", "/api/links/ping/history", "")
+	json.NewDecoder(resp.Body).Decode(&pings)
+	require.Len(pings, 2)
+	resp = send("POST", "/api/links/ping/history/"+pings[1].ID+"/rollback", "")
+	require.Equal(400, resp.StatusCode)
+
+	// The history of anonymous links is only as open as the links themselves
+	resp = sendAs("", "POST", "/open-history", `{"url": "https://example.com/open"}`)
+	require.Equal(201, resp.StatusCode)
+	resp = sendAs("", "POST", "/locked-history", `{"url": "https://example.com/locked", "password": "hunter2"}`)
+	require.Equal(201, resp.StatusCode)
+	resp = sendAs("", "POST", "/glimpse-history", `{"content": "Only once", "once": true}`)
+	require.Equal(201, resp.StatusCode)
+	resp = sendAs("", "GET", "/api/links/open-history/history", "")
+	require.Equal(200, resp.StatusCode)
+	resp = sendAs("", "GET", "/api/links/locked-history/history", "")
+	require.Equal(403, resp.StatusCode)
+	resp = sendAs("kim-key", "GET", "/api/links/glimpse-history/history", "")
+	require.Equal(403, resp.StatusCode)
+}
+
+func TestLinkAliases(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	send := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		require.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := testClient.Do(req)
+		require.NoError(err)
+		return resp
+	}
+
+	resp := send("POST", "/onboarding", `{"url": "https://example.com/onboarding", "aliases": ["welcome", "Start"]}`)
+	require.Equal(201, resp.StatusCode)
+
+	resp = send("GET", "/welcome", "")
+	require.Equal(302, resp.StatusCode)
+	require.Equal("https://example.com/onboarding", resp.Header.Get("Location"))
+	resp = send("GET", "/start", "")
+	require.Equal(302, resp.StatusCode)
+
+	link := &Link{ID: "onboarding"}
+	require.NoError(db.Get(link))
+	require.Equal(int64(2), link.HitCount)
+
+	resp = send("POST", "/other", `{"url": "https://example.com/", "aliases": ["start"]}`)
+	require.Equal(400, resp.StatusCode)
+	resp = send("POST", "/other", `{"url": "https://example.com/", "aliases": ["onboarding"]}`)
+	require.Equal(400, resp.StatusCode)
+	resp = send("POST", "/Welcome", `{"url": "https://example.com/"}`)
+	require.Equal(400, resp.StatusCode)
+
+	resp = send("PATCH", "/start", `{"title": "Onboarding"}`)
+	require.Equal(200, resp.StatusCode)
+	link = &Link{ID: "onboarding"}
+	require.NoError(db.Get(link))
+	require.Equal("Onboarding", link.Title)
+
+	resp = send("PATCH", "/onboarding", `{"aliases": ["welcome"]}`)
+	require.Equal(200, resp.StatusCode)
+	resp = send("GET", "/start", "")
+	require.Equal(404, resp.StatusCode)
+	resp = send("GET", "/welcome", "")
+	require.Equal(302, resp.StatusCode)
+
+	resp = send("DELETE", "/welcome", "")
+	require.Equal(200, resp.StatusCode)
+	resp = send("GET", "/onboarding", "")
+	require.Equal(404, resp.StatusCode)
+	resp = send("POST", "/welcome/restore", "")
+	require.Equal(200, resp.StatusCode)
+	resp = send("GET", "/onboarding", "")
+	require.Equal(302, resp.StatusCode)
+}
+
+func TestLinkPaste(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	config.APIKeys = map[string]string{"sam-key": "sam"}
+	defer func() { config.APIKeys = nil }()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	send := func(method, path, contentType, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		require.NoError(err)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", "text/html")
+		req.Header.Set("Authorization", "Bearer sam-key")
+		resp, err := testClient.Do(req)
+		require.NoError(err)
+		return resp
+	}
+
+	resp := send("POST", "/notes", "text/markdown", "# Notes\n\nSee <b>this</b>")
+	require.Equal(201, resp.StatusCode)
+	require.Empty(resp.Header.Get("Location"))
+
+	resp = send("GET", "/notes", "", "")
+	require.Equal(200, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Contains(string(body), "<h1>Notes</h1>")
+	require.Contains(string(body), "&lt;b&gt;this&lt;/b&gt;")
+
+	resp = send("POST", "/secret?once=true", "text/plain", "hunter2")
+	require.Equal(201, resp.StatusCode)
+
+	var links []Link
+	resp = send("GET", "/api/links?q=hunter2", "", "")
+	require.Equal(200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&links)
+	require.Len(links, 1)
+	require.Equal("secret", links[0].ID)
+	require.Empty(links[0].Content)
+
+	resp = send("GET", "/secret/preview", "", "")
+	require.Equal(200, resp.StatusCode)
+	require.Equal("no-store", resp.Header.Get("Cache-Control"))
+	body, err = ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Contains(string(body), "<pre>hunter2</pre>")
+
+	resp = send("GET", "/secret", "", "")
+	require.NotEqual(200, resp.StatusCode)
+
+	resp = send("POST", "/mixed", "application/json", `{"url": "https://example.com/", "content": "text"}`)
+	require.Equal(400, resp.StatusCode)
+}
+
+func TestLinkEncrypted(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	send := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		require.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "text/html")
+		resp, err := testClient.Do(req)
+		require.NoError(err)
+		return resp
+	}
+
+	ciphertext := encryptURL(t, make([]byte, 32), "https://example.com/secret")
+
+	resp := send("POST", "/sealed", `{"ciphertext": "`+ciphertext+`"}`)
+	require.Equal(201, resp.StatusCode)
+	require.Empty(resp.Header.Get("Location"))
+
+	resp = send("GET", "/sealed", "")
+	require.Equal(200, resp.StatusCode)
+	require.Empty(resp.Header.Get("Location"))
+	require.Equal("no-referrer", resp.Header.Get("Referrer-Policy"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Contains(string(body), ciphertext)
+	require.NotContains(string(body), "example.com")
+
+	resp = send("GET", "/sealed/preview", "")
+	require.Equal(200, resp.StatusCode)
+	body, err = ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Contains(string(body), ciphertext)
+
+	link := &Link{ID: "sealed"}
+	require.NoError(db.Get(link))
+	require.Empty(link.URL)
+	require.Equal(int64(2), link.HitCount)
+
+	resp = send("POST", "/mixed", `{"url": "https://example.com/", "ciphertext": "`+ciphertext+`"}`)
+	require.Equal(400, resp.StatusCode)
+}
+
+func TestLinkCollection(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	send := func(method, path, accept, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		require.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", accept)
+		resp, err := testClient.Do(req)
+		require.NoError(err)
+		return resp
+	}
+
+	resp := send("POST", "/bio", "application/json", `{"title": "Me", "description": "Find me here", "items": [
+		{"title": "Blog", "url": "https://example.com/blog"},
+		{"title": "Shop", "url": "https://example.com/shop"}
+	]}`)
+	require.Equal(201, resp.StatusCode)
+	require.Empty(resp.Header.Get("Location"))
+
+	resp = send("GET", "/bio", "text/html", "")
+	require.Equal(200, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Contains(string(body), "<h1>Me</h1>")
+	require.Contains(string(body), "<p>Find me here</p>")
+	require.Contains(string(body), `<a href="/bio/2" rel="nofollow noopener">Shop</a>`)
+
+	resp = send("GET", "/bio/2", "text/html", "")
+	require.Equal(302, resp.StatusCode)
+	require.Equal("https://example.com/shop", resp.Header.Get("Location"))
+	resp = send("GET", "/bio/3", "text/html", "")
+	require.Equal(404, resp.StatusCode)
+
+	resp = send("PATCH", "/bio", "application/json", `{"items": [
+		{"id": "2", "title": "Shop", "url": "https://example.com/shop"},
+		{"id": "1", "title": "Blog", "url": "https://example.com/blog"}
+	]}`)
+	require.Equal(200, resp.StatusCode)
+
+	resp = send("GET", "/bio", "application/json", "")
+	require.Equal(200, resp.StatusCode)
+	link := &Link{}
+	require.NoError(json.NewDecoder(resp.Body).Decode(link))
+	require.Len(link.Items, 2)
+	require.Equal("2", link.Items[0].ID)
+	require.Equal(int64(1), link.Items[0].Hits)
+	require.Equal(int64(0), link.Items[1].Hits)
+
+	require.NoError(db.Get(link))
+	require.Equal(int64(2), link.HitCount)
+}
+
+func TestLinkInterstitial(t *testing.T) {
+	require := require.New(t)
+
+	rec, err := MockHTTP(t)
+	require.NoError(err)
+	defer rec.Stop()
+
+	config.Interstitial = InterstitialPolicy{Domains: []string{"*.example.org"}, Countdown: 5}
+	defer func() { config.Interstitial = InterstitialPolicy{} }()
+
+	r, err := CreateServer(GetDatabaseURL())
+	require.NoError(err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	send := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		require.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "text/html")
+		resp, err := testClient.Do(req)
+		require.NoError(err)
+		return resp
+	}
+
+	resp := send("POST", "/careful", `{"url": "https://example.com/", "interstitial": true}`)
+	require.Equal(201, resp.StatusCode)
+	resp = send("POST", "/listed", `{"url": "https://www.example.org/"}`)
+	require.Equal(201, resp.StatusCode)
+	resp = send("POST", "/direct", `{"url": "https://example.com/direct"}`)
+	require.Equal(201, resp.StatusCode)
+
+	resp = send("GET", "/careful", "")
+	require.Equal(200, resp.StatusCode)
+	require.Empty(resp.Header.Get("Location"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Contains(string(body), `<a id="continue" href="https://example.com/" rel="nofollow noopener noreferrer">`)
+	require.Contains(string(body), `<span id="countdown">5</span>`)
+
+	resp = send("GET", "/listed", "")
+	require.Equal(200, resp.StatusCode)
+	body, err = ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Contains(string(body), `href="https://www.example.org/"`)
+
+	// Showing the interstitial uses up the hit of a once link
+	resp = send("POST", "/glimpse", `{"url": "https://www.example.org/glimpse", "once": true}`)
+	require.Equal(201, resp.StatusCode)
+	resp = send("GET", "/glimpse", "")
+	require.Equal(200, resp.StatusCode)
+	resp = send("GET", "/glimpse", "")
+	require.Equal(410, resp.StatusCode)
+
+	resp = send("GET", "/direct", "")
+	require.Equal(302, resp.StatusCode)
+	require.Equal("https://example.com/direct", resp.Header.Get("Location"))
+
+	// New links can't skip the interstitial by claiming to be old
+	config.Interstitial = InterstitialPolicy{NewerThan: time.Hour}
+	resp = send("POST", "/backdated", `{"url": "https://example.com/backdated", "@timestamp": "2000-01-01T00:00:00Z"}`)
+	require.Equal(201, resp.StatusCode)
+	resp = send("GET", "/backdated", "")
+	require.Equal(200, resp.StatusCode)
+	require.Empty(resp.Header.Get("Location"))
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// placeholderPattern matches the placeholders of template links. They are
+// either positional like `{1}` or named like `{org}`.
+var placeholderPattern = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// isTemplate tells you if a URL has placeholders to fill in
+func isTemplate(rawurl string) bool {
+	return placeholderPattern.MatchString(rawurl)
+}
+
+// canonicalTemplate canonicalises a template URL like canonicalURL. The
+// placeholders are swapped for plain tokens while that is done, so they are
+// not escaped, and they are only allowed in the path, query and fragment.
+func canonicalTemplate(rawurl string, stripTracking bool) (string, error) {
+	placeholders := map[string]string{}
+	tokenised := placeholderPattern.ReplaceAllStringFunc(rawurl, func(placeholder string) string {
+		token := "tmplplaceholder" + strconv.Itoa(len(placeholders)) + "x"
+		placeholders[token] = placeholder
+		return token
+	})
+
+	canonical, err := canonicalURL(tokenised, stripTracking)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(canonical)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(u.Scheme+u.Host, "tmplplaceholder") {
+		return "", errors.New("Placeholders are only allowed in the path, query and fragment")
+	}
+
+	for token, placeholder := range placeholders {
+		canonical = strings.Replace(canonical, token, placeholder, -1)
+	}
+	return canonical, nil
+}
+
+// exampleTemplate fills every placeholder of a template with the same value
+// so the result can be checked like any other URL
+func exampleTemplate(rawurl string) string {
+	return placeholderPattern.ReplaceAllString(rawurl, "x")
+}
+
+// Expand fills in the placeholders of a template link. Positional
+// placeholders like `{1}` take the argument at that position. Named
+// placeholders take the query parameter of the same name or otherwise the
+// arguments in the order they first appear. Values are escaped for the part
+// of the URL they end up in.
+func (link *Link) Expand(args []string, query url.Values) (string, error) {
+	queryStart := strings.IndexAny(link.URL, "?#")
+	named := map[string]string{}
+	namedArgs := 0
+	used := 0
+
+	value := func(name string) (string, error) {
+		position, err := strconv.Atoi(name)
+		isNamed := err != nil
+		if isNamed {
+			if v, ok := named[name]; ok {
+				return v, nil
+			}
+			if v := query.Get(name); v != "" {
+				named[name] = v
+				return v, nil
+			}
+			namedArgs++
+			position = namedArgs
+		}
+		if position < 1 || position > len(args) {
+			return "", errors.New("Missing value for {" + name + "}")
+		}
+		if position > used {
+			used = position
+		}
+		if isNamed {
+			named[name] = args[position-1]
+		}
+		return args[position-1], nil
+	}
+
+	expanded := ""
+	last := 0
+	for _, match := range placeholderPattern.FindAllStringSubmatchIndex(link.URL, -1) {
+		v, err := value(link.URL[match[2]:match[3]])
+		if err != nil {
+			return "", err
+		}
+		expanded += link.URL[last:match[0]] + escapeArgument(v, queryStart >= 0 && match[0] > queryStart)
+		last = match[1]
+	}
+	expanded += link.URL[last:]
+
+	if len(args) > used {
+		return "", errors.New("Too many values for link")
+	}
+	return expanded, nil
+}
+
+// escapeArgument escapes a value that is put in a path segment or query
+func escapeArgument(value string, inQuery bool) string {
+	if inQuery {
+		return url.QueryEscape(value)
+	}
+	// Dot segments would let the value move up the path of the destination
+	if value == "." || value == ".." {
+		return strings.Replace(value, ".", "%2E", -1)
+	}
+	return url.PathEscape(value)
+}
+
+// templateArgs splits the path after the ID of a template link into
+// arguments
+func templateArgs(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalTemplate(t *testing.T) {
+	require := require.New(t)
+
+	canonical, err := canonicalTemplate("HTTPS://GitHub.com:443/{org}/{repo}/issues?q={1}", false)
+	require.NoError(err)
+	require.Equal("https://github.com/{org}/{repo}/issues?q={1}", canonical)
+
+	_, err = canonicalTemplate("https://{1}.example.com/", false)
+	require.Error(err)
+}
+
+func TestLinkExpand(t *testing.T) {
+	require := require.New(t)
+
+	link := &Link{URL: "https://tracker.example.com/browse/{1}"}
+	destination, err := link.Expand([]string{"PROJ-1"}, nil)
+	require.NoError(err)
+	require.Equal("https://tracker.example.com/browse/PROJ-1", destination)
+
+	_, err = link.Expand(nil, nil)
+	require.Error(err)
+	_, err = link.Expand([]string{"PROJ-1", "extra"}, nil)
+	require.Error(err)
+
+	destination, err = link.Expand([]string{".."}, nil)
+	require.NoError(err)
+	require.Equal("https://tracker.example.com/browse/%2E%2E", destination)
+
+	link = &Link{URL: "https://github.com/{org}/{repo}?q={org}+{term}"}
+	destination, err = link.Expand([]string{"golang", "go"}, url.Values{"term": {"a&b c"}})
+	require.NoError(err)
+	require.Equal("https://github.com/golang/go?q=golang+a%26b+c", destination)
+
+	destination, err = link.Expand([]string{"a b", "c/d"}, url.Values{"term": {"x"}})
+	require.NoError(err)
+	require.Equal("https://github.com/a%20b/c%2Fd?q=a+b+x", destination)
+}
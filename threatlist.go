@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ThreatList is a locally stored list of unsafe destinations. Every line of
+// the file is either a domain, which also matches all of its subdomains, or a
+// hex encoded prefix of the SHA256 hash of a URL expression, in the same way
+// as Safe Browsing update files. Empty lines and lines starting with `#` are
+// ignored. The file is read again when it changes.
+type ThreatList struct {
+	Path string
+
+	file *watchedFile
+}
+
+// threatEntries are the entries of a threat list file
+type threatEntries struct {
+	domains       map[string]bool
+	prefixes      map[string]bool
+	prefixLengths []int
+}
+
+// NewThreatList loads the threat list at the given path
+func NewThreatList(path string) (*ThreatList, error) {
+	file, err := watchFile(path, parseThreatList)
+	if err != nil {
+		return nil, err
+	}
+	return &ThreatList{Path: path, file: file}, nil
+}
+
+func parseThreatList(file *os.File) (interface{}, error) {
+	domains := map[string]bool{}
+	prefixes := map[string]bool{}
+	lengths := map[int]bool{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if isHashPrefix(line) {
+			prefixes[line] = true
+			lengths[len(line)] = true
+			continue
+		}
+		domain, err := asciiHostname(strings.Trim(line, "."))
+		if err != nil {
+			continue
+		}
+		domains[domain] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	prefixLengths := []int{}
+	for length := range lengths {
+		prefixLengths = append(prefixLengths, length)
+	}
+	sort.Ints(prefixLengths)
+
+	return &threatEntries{domains: domains, prefixes: prefixes, prefixLengths: prefixLengths}, nil
+}
+
+// Match tells you if the URL is on the threat list. A nil ThreatList matches
+// nothing.
+func (list *ThreatList) Match(rawurl string) bool {
+	if list == nil {
+		return false
+	}
+	entries := list.file.Value().(*threatEntries)
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	host, err := asciiHostname(strings.TrimSuffix(u.Hostname(), "."))
+	if err != nil {
+		return false
+	}
+
+	for _, suffix := range hostSuffixes(host, -1) {
+		if entries.domains[suffix] {
+			return true
+		}
+	}
+
+	if len(entries.prefixes) == 0 {
+		return false
+	}
+	for _, expression := range urlExpressions(host, u) {
+		sum := sha256.Sum256([]byte(expression))
+		hash := hex.EncodeToString(sum[:])
+		for _, length := range entries.prefixLengths {
+			if entries.prefixes[hash[:length]] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isHashPrefix tells you if a line is a hex encoded hash prefix of 4 to 32
+// bytes
+func isHashPrefix(line string) bool {
+	if len(line) < 8 || len(line) > 64 || len(line)%2 != 0 {
+		return false
+	}
+	_, err := hex.DecodeString(line)
+	return err == nil
+}
+
+// hostSuffixes returns the host followed by its parent domains, leaving out
+// the top level domain. At most max suffixes are returned, or all of them if
+// max is negative.
+func hostSuffixes(host string, max int) []string {
+	suffixes := []string{host}
+	labels := strings.Split(host, ".")
+	for i := 1; i < len(labels)-1; i++ {
+		if max >= 0 && len(suffixes) >= max {
+			break
+		}
+		suffixes = append(suffixes, strings.Join(labels[i:], "."))
+	}
+	return suffixes
+}
+
+// urlExpressions returns the host suffix and path prefix combinations of a
+// URL that are hashed when looking it up, as described by the Safe Browsing
+// API.
+func urlExpressions(host string, u *url.URL) []string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	paths := []string{}
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+	if path != "/" {
+		paths = append(paths, "/")
+		segments := strings.Split(strings.Trim(path, "/"), "/")
+		for i := 1; i < len(segments) && i <= 3; i++ {
+			paths = append(paths, "/"+strings.Join(segments[:i], "/")+"/")
+		}
+	}
+
+	expressions := []string{}
+	for _, suffix := range hostSuffixes(host, 5) {
+		for _, p := range paths {
+			expressions = append(expressions, suffix+p)
+		}
+	}
+	return expressions
+}
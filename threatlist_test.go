@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestThreatListMatch(t *testing.T) {
+	require := require.New(t)
+
+	sum := sha256.Sum256([]byte("phish.example/login/"))
+	file, err := ioutil.TempFile("", "threats")
+	require.NoError(err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("# unsafe destinations\nmalware.example\n" + hex.EncodeToString(sum[:4]) + "\n")
+	require.NoError(err)
+	require.NoError(file.Close())
+
+	list, err := NewThreatList(file.Name())
+	require.NoError(err)
+
+	require.True(list.Match("https://malware.example/"))
+	require.True(list.Match("https://cdn.malware.example/file.exe"))
+	require.True(list.Match("https://phish.example/login/form?user=1"))
+	require.True(list.Match("https://www.phish.example/login/"))
+	require.False(list.Match("https://phish.example/"))
+	require.False(list.Match("https://example.com/"))
+
+	var nilList *ThreatList
+	require.False(nilList.Match("https://malware.example/"))
+
+	err = ioutil.WriteFile(file.Name(), []byte("example.com\n"), 0644)
+	require.NoError(err)
+	future := time.Now().Add(time.Minute)
+	require.NoError(os.Chtimes(file.Name(), future, future))
+	list.file.checked = time.Time{}
+
+	require.True(list.Match("https://example.com/"))
+	require.False(list.Match("https://malware.example/"))
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// purgeInterval is how often the trash is emptied of old links
+const purgeInterval = time.Hour
+
+// purgeTrash permanently deletes the links that were moved to the trash
+// longer than TrashPeriod before now and returns how many there were
+func purgeTrash(now time.Time) (int, error) {
+	before := now.Add(-config.TrashPeriod).UTC().Format(time.RFC3339Nano)
+	return db.DeleteByQuery(&Link{}, map[string]interface{}{
+		"query": map[string]interface{}{
+			"range": map[string]interface{}{
+				"deleted_at": map[string]interface{}{"lt": before},
+			},
+		},
+	})
+}
+
+// purgeTrashEvery keeps purging the trash in the background
+func purgeTrashEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := purgeTrash(time.Now()); err != nil {
+			log.Println("Could not purge trash:", err)
+		}
+	}
+}
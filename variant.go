@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxVariants is the most destinations a link can be split between
+const maxVariants = 20
+
+// maxVariantWeight is the largest weight of a variant, it keeps the total
+// weight of all variants from overflowing
+const maxVariantWeight = 1 << 20
+
+// variantCookieAge is how long a visitor keeps getting the same variant
+const variantCookieAge = 30 * 24 * time.Hour
+
+// Variant is one of several weighted destinations of a link
+type Variant struct {
+	URL    string `json:"url" form:"url"`
+	Weight int64  `json:"weight" form:"weight"`
+	// Hits is how many times this variant was served
+	Hits int64 `json:"hits" form:"-"`
+}
+
+func (variant Variant) String() string {
+	return strconv.FormatInt(variant.Weight, 10) + " " + variant.URL
+}
+
+// bindVariants validates the variants of a link and canonicalises their
+// URLs
+func (link *Link) bindVariants() error {
+	if len(link.Variants) == 0 {
+		return nil
+	}
+	if len(link.Variants) > maxVariants {
+		return errors.New("A link can have at most " + strconv.Itoa(maxVariants) + " variants")
+	}
+	if isTemplate(link.URL) {
+		return errors.New("Template links can not have variants")
+	}
+
+	for i := range link.Variants {
+		variant := &link.Variants[i]
+		if variant.Weight <= 0 || variant.Weight > maxVariantWeight {
+			return errors.New("Variant weights must be between 1 and " + strconv.Itoa(maxVariantWeight))
+		}
+		if isTemplate(variant.URL) {
+			return errors.New("Variant URLs can not have placeholders")
+		}
+		canonical, err := checkDestination(variant.URL)
+		if err != nil {
+			return err
+		}
+		variant.URL = canonical
+		variant.Hits = 0
+	}
+	return nil
+}
+
+// pickVariant chooses the variant to serve to a visitor and remembers it in
+// a cookie so the visitor keeps getting the same one. It returns -1 for links
+// without variants.
+func (link *Link) pickVariant(w http.ResponseWriter, r *http.Request) int {
+	if len(link.Variants) == 0 {
+		return -1
+	}
+
+	name := "variant_" + strings.ToLower(link.ID)
+	if cookie, err := r.Cookie(name); err == nil {
+		if i, err := strconv.Atoi(cookie.Value); err == nil && i >= 0 && i < len(link.Variants) {
+			return i
+		}
+	}
+
+	var total int64
+	for _, variant := range link.Variants {
+		total += variant.Weight
+	}
+	pick := rand.Int63n(total)
+	chosen := len(link.Variants) - 1
+	for i, variant := range link.Variants {
+		if pick < variant.Weight {
+			chosen = i
+			break
+		}
+		pick -= variant.Weight
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:  name,
+		Value: strconv.Itoa(chosen),
+		// Links can also be reached through their aliases
+		Path:     "/",
+		MaxAge:   int(variantCookieAge.Seconds()),
+		HttpOnly: true,
+	})
+	return chosen
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// watchCheckInterval is how often watched files are checked for changes
+const watchCheckInterval = time.Second
+
+// watchedFile is a file that is read again when it changes. parse turns its
+// content into the value that is handed out.
+type watchedFile struct {
+	path  string
+	parse func(file *os.File) (interface{}, error)
+
+	mu      sync.RWMutex
+	modTime time.Time
+	checked time.Time
+	value   interface{}
+}
+
+// watchFile loads the file at the given path with parse
+func watchFile(path string, parse func(file *os.File) (interface{}, error)) (*watchedFile, error) {
+	watched := &watchedFile{path: path, parse: parse}
+	if err := watched.load(); err != nil {
+		return nil, err
+	}
+	return watched, nil
+}
+
+func (watched *watchedFile) load() error {
+	file, err := os.Open(watched.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	value, err := watched.parse(file)
+	if err != nil {
+		return err
+	}
+
+	watched.mu.Lock()
+	defer watched.mu.Unlock()
+	watched.modTime = info.ModTime()
+	watched.checked = time.Now()
+	watched.value = value
+	return nil
+}
+
+// reload reads the file again if it has changed since it was last loaded.
+// Errors leave the previously loaded value in place.
+func (watched *watchedFile) reload() {
+	watched.mu.RLock()
+	due := time.Since(watched.checked) >= watchCheckInterval
+	modTime := watched.modTime
+	watched.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	info, err := os.Stat(watched.path)
+	if err != nil || info.ModTime().Equal(modTime) {
+		watched.mu.Lock()
+		watched.checked = time.Now()
+		watched.mu.Unlock()
+		return
+	}
+	watched.load()
+}
+
+// Value returns what parse made of the current content of the file
+func (watched *watchedFile) Value() interface{} {
+	watched.reload()
+
+	watched.mu.RLock()
+	defer watched.mu.RUnlock()
+	return watched.value
+}